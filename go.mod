@@ -2,13 +2,16 @@ module src/main.go
 
 go 1.20
 
+require (
+	github.com/emersion/go-vcard v0.0.0-20241024213814-c9703dde27ff
+	github.com/lukechampine/nock v0.0.0-20200703235947-05b9fae14d60
+	github.com/mmcdole/gofeed v1.3.0
+)
+
 require (
 	github.com/PuerkitoBio/goquery v1.8.0 // indirect
 	github.com/andybalholm/cascadia v1.3.1 // indirect
-	github.com/emersion/go-vcard v0.0.0-20241024213814-c9703dde27ff // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
-	github.com/lukechampine/nock v0.0.0-20200703235947-05b9fae14d60 // indirect
-	github.com/mmcdole/gofeed v1.3.0 // indirect
 	github.com/mmcdole/goxpp v1.1.1-0.20240225020742-a0c311522b23 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const adminCommand = "admin"
+
+// pinHashRounds slows down guessing a PIN from a stolen config file.
+const pinHashRounds = 100000
+
+const defaultAdminTimeoutMinutes = 5
+
+// hashPin returns "sha256:<salt>:<hash>" for pin, where hash is SHA-256
+// applied pinHashRounds times to salt and pin.
+func hashPin(pin string, salt []byte) string {
+	sum := sha256.Sum256(append(append([]byte{}, salt...), pin...))
+	for i := 1; i < pinHashRounds; i++ {
+		sum = sha256.Sum256(sum[:])
+	}
+	return "sha256:" + hex.EncodeToString(salt) + ":" + hex.EncodeToString(sum[:])
+}
+
+func newPinHash(pin string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hashPin(pin, salt), nil
+}
+
+func parsePinHash(hash string) ([]byte, error) {
+	parts := strings.Split(hash, ":")
+	if len(parts) != 3 || parts[0] != "sha256" {
+		return nil, fmt.Errorf("not a PIN hash made by kidsh -set-pin")
+	}
+	return hex.DecodeString(parts[1])
+}
+
+func checkPin(hash, pin string) bool {
+	salt, err := parsePinHash(hash)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashPin(pin, salt)), []byte(hash)) == 1
+}
+
+// readSecret reads a line without showing what is typed.
+func readSecret(c *CommandContext, prompt string) (string, error) {
+	return readTyped(c, prompt, true)
+}
+
+// readAnswer reads a line typed in answer to a question. Unlike reading
+// Stdin directly, Ctrl-C or stopping the command, say at bedtime, stops it
+// with errInterrupted.
+func readAnswer(c *CommandContext, prompt string) (string, error) {
+	return readTyped(c, prompt, false)
+}
+
+// readTyped reads a line, showing a * for each key if secret is set. Stdin
+// is read one byte at a time so that nothing after the line is swallowed.
+func readTyped(c *CommandContext, prompt string, secret bool) (string, error) {
+	fmt.Fprint(c.Stdout, prompt)
+	echo := false
+	if t, ok := c.Stdin.(*terminal); ok && isTerminal(int(t.Fd())) {
+		restore, err := t.readKeys(c.Ctx)
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+		echo = !secret
+	}
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if c.Ctx.Err() != nil {
+			fmt.Fprintln(c.Stdout)
+			return "", errInterrupted
+		}
+		n, err := c.Stdin.Read(b)
+		if n == 0 {
+			if err != nil && c.Ctx.Err() != nil {
+				err = errInterrupted
+			}
+			if err != nil {
+				fmt.Fprintln(c.Stdout)
+				return "", err
+			}
+			continue
+		}
+		switch b[0] {
+		case keyReturn, keyLineFeed:
+			fmt.Fprintln(c.Stdout)
+			return string(line), nil
+		case keyCtrlC:
+			fmt.Fprintln(c.Stdout)
+			return "", errInterrupted
+		case keyDelete, keyBackspace:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				fmt.Fprint(c.Stdout, "\b \b")
+			}
+		default:
+			line = append(line, b[0])
+			if secret {
+				fmt.Fprint(c.Stdout, "*")
+			} else if echo {
+				c.Stdout.Write(b)
+			}
+		}
+	}
+}
+
+func (s *Session) adminUnlocked(now time.Time) bool {
+	return now.Before(s.AdminUntil)
+}
+
+// unlockAdmin asks for the parent PIN unless admin mode is already
+// unlocked, and keeps it unlocked for the configured timeout.
+func unlockAdmin(c *CommandContext) error {
+	now := c.Clock.Now()
+	if c.Session.adminUnlocked(now) {
+		return nil
+	}
+	if c.Config.AdminPinHash == "" {
+		return fmt.Errorf("no parent PIN is set; start kidsh with -set-pin to set one")
+	}
+	pin, err := readSecret(c, "Parent PIN: ")
+	if err != nil {
+		return err
+	}
+	if !checkPin(c.Config.AdminPinHash, pin) {
+		c.auditDenied([]string{adminCommand}, "wrong PIN")
+		// Make guessing slow.
+		if err := c.sleep(time.Second); err != nil {
+			return err
+		}
+		return fmt.Errorf("that's not the right PIN")
+	}
+	timeout := time.Duration(c.Config.AdminTimeoutMinutes) * time.Minute
+	c.Session.AdminUntil = now.Add(timeout)
+	fmt.Fprintf(c.Stdout, "Admin mode is unlocked until %s.\n", c.Session.AdminUntil.Format("3:04 PM"))
+	return nil
+}
+
+// userConfigPath is where a config file is created if there isn't one.
+func userConfigPath() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, appName, configFileName)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", appName, configFileName)
+	}
+	return filepath.Join("/etc", appName, configFileName)
+}
+
+// updateConfig applies change to the running config and to the config file
+// so that it sticks. Environment overrides are not written to the file.
+func updateConfig(live *Config, change func(c *Config)) error {
+	path := configPath
+	if path == "" {
+		path = userConfigPath()
+	}
+	saved := defaultConfig()
+	if _, err := os.Stat(path); err == nil {
+		if err := saved.LoadFromFile(path); err != nil {
+			return err
+		}
+	}
+	change(saved)
+	if err := saved.Validate(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := saved.SaveToFile(path); err != nil {
+		return err
+	}
+	configPath = path
+	change(live)
+	return nil
+}
+
+// commandName returns the full name of a command or alias.
+func commandName(name string) (string, error) {
+	cmd, ok := cmds[name]
+	if !ok {
+		return "", fmt.Errorf("there is no command named %q", name)
+	}
+	return cmd.Name, nil
+}
+
+type adminSubcommand struct {
+	usage       string
+	description string
+	run         func(c *CommandContext, args []string) error
+}
+
+var adminSubcommands = map[string]adminSubcommand{
+	"disable": {"disable <command>", "Turn a command off for everyone", adminDisable},
+	"enable":  {"enable <command>", "Turn a command back on", adminEnable},
+	"bedtime": {"bedtime <HH:MM>", "Set bedtime", adminBedtime},
+	"news":    {"news <url>", "Set the RSS feed for the news command", adminNews},
+	"todos":   {"todos <profile>", "Clear a child's todo list", adminResetTodos},
+	"history": {"history [-day D] [-command C] [-n N]", "Show what was run, newest last", adminHistory},
+	"pin":     {"pin", "Change the parent PIN", adminPin},
+	"lock":    {"lock", "Leave admin mode", adminLock},
+}
+
+func adminHelp(c *CommandContext) {
+	names := make([]string, 0, len(adminSubcommands))
+	for name := range adminSubcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	width := 0
+	for _, name := range names {
+		if n := len(adminSubcommands[name].usage); n > width {
+			width = n
+		}
+	}
+	for _, name := range names {
+		sub := adminSubcommands[name]
+		fmt.Fprintf(c.Stdout, "admin %-*s  %s\n", width, sub.usage, sub.description)
+	}
+}
+
+func doAdmin(c *CommandContext, args []string) error {
+	if err := unlockAdmin(c); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		adminHelp(c)
+		return nil
+	}
+	sub, ok := adminSubcommands[args[0]]
+	if !ok {
+		adminHelp(c)
+		return fmt.Errorf("unknown admin command %q", args[0])
+	}
+	return sub.run(c, args[1:])
+}
+
+func adminDisable(c *CommandContext, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: admin disable <command>")
+	}
+	name, err := commandName(args[0])
+	if err != nil {
+		return err
+	}
+	if name == adminCommand {
+		return fmt.Errorf("admin cannot be turned off")
+	}
+	err = updateConfig(c.Config, func(cfg *Config) {
+		if !slices.Contains(cfg.DisabledCommands, name) {
+			cfg.DisabledCommands = append(cfg.DisabledCommands, name)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Stdout, "%s is now turned off.\n", name)
+	return nil
+}
+
+func adminEnable(c *CommandContext, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: admin enable <command>")
+	}
+	name, err := commandName(args[0])
+	if err != nil {
+		return err
+	}
+	err = updateConfig(c.Config, func(cfg *Config) {
+		enabled := cfg.DisabledCommands[:0:0]
+		for _, disabled := range cfg.DisabledCommands {
+			if disabled != name {
+				enabled = append(enabled, disabled)
+			}
+		}
+		cfg.DisabledCommands = enabled
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Stdout, "%s is now turned on.\n", name)
+	return nil
+}
+
+func adminBedtime(c *CommandContext, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: admin bedtime <HH:MM>")
+	}
+	hour, minute, err := parseClockTime(args[0])
+	if err != nil {
+		return err
+	}
+	err = updateConfig(c.Config, func(cfg *Config) {
+		cfg.BedtimeHour, cfg.BedtimeMinute = hour, minute
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Stdout, "Bedtime is now %02d:%02d.\n", hour, minute)
+	return nil
+}
+
+func adminNews(c *CommandContext, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: admin news <url>")
+	}
+	err := updateConfig(c.Config, func(cfg *Config) {
+		cfg.RSSURL = args[0]
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Stdout, "The news now comes from %s.\n", args[0])
+	return nil
+}
+
+func adminResetTodos(c *CommandContext, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: admin todos <profile>")
+	}
+	profile := args[0]
+	if profile != defaultProfile && c.Config.Profiles[profile] == nil {
+		return fmt.Errorf("there is no profile named %q", profile)
+	}
+	dir, err := profileDir(profile)
+	if err != nil {
+		return err
+	}
+	// A child who has never used the shell has no files, and so no todos.
+	path, err := (&Session{Dir: dir}).todoPath(c.Config.TodoFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	fmt.Fprintf(c.Stdout, "Cleared the todo list of %s.\n", profile)
+	return nil
+}
+
+func adminHistory(c *CommandContext, args []string) error {
+	fs := flag.NewFlagSet("admin history", flag.ContinueOnError)
+	fs.SetOutput(c.Stdout)
+	day := fs.String("day", "", "only show this day, like 2025-03-14, today or yesterday")
+	command := fs.String("command", "", "only show this command")
+	n := fs.Int("n", 20, "show at most this many entries")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	if *n < 1 {
+		return fmt.Errorf("-n must be at least 1, got %d; use admin history -n 10 to see the last 10", *n)
+	}
+	now := c.Clock.Now()
+	switch *day {
+	case "today":
+		*day = now.Format("2006-01-02")
+	case "yesterday":
+		*day = now.AddDate(0, 0, -1).Format("2006-01-02")
+	case "":
+	default:
+		if _, err := time.Parse("2006-01-02", *day); err != nil {
+			return fmt.Errorf("%q is not a day like 2025-03-14", *day)
+		}
+	}
+	if name, err := commandName(*command); err == nil {
+		*command = name
+	}
+	entries, err := readAuditLog(c.Config.AuditLogFile, c.Config.AuditLogMaxFiles)
+	if err != nil {
+		return err
+	}
+	var shown []AuditEntry
+	for _, e := range entries {
+		e.Time = e.Time.In(now.Location())
+		if *day != "" && e.Time.Format("2006-01-02") != *day {
+			continue
+		}
+		if *command != "" && e.Command != *command {
+			continue
+		}
+		shown = append(shown, e)
+	}
+	if len(shown) > *n {
+		shown = shown[len(shown)-*n:]
+	}
+	if len(shown) == 0 {
+		fmt.Fprintln(c.Stdout, "Nothing was run.")
+	}
+	for _, e := range shown {
+		typed := e.Command
+		if e.Alias != "" {
+			typed = e.Alias
+		}
+		line := strings.Join(append([]string{typed}, e.Args...), " ")
+		switch {
+		case e.Denied:
+			line += "  (denied: " + e.Error + ")"
+		case e.Error != "":
+			line += "  (error: " + e.Error + ")"
+		}
+		if e.Duration >= time.Second {
+			line += "  [" + e.Duration.Round(time.Second).String() + "]"
+		}
+		fmt.Fprintf(c.Stdout, "%s  %-10s %s\n", e.Time.Format("2006-01-02 15:04:05"), e.Profile, line)
+	}
+	return nil
+}
+
+// askNewPin asks for a new PIN twice and returns its hash.
+func askNewPin(c *CommandContext) (string, error) {
+	pin, err := readSecret(c, "New parent PIN: ")
+	if err != nil {
+		return "", err
+	}
+	if len(pin) < 4 {
+		return "", fmt.Errorf("the PIN must be at least 4 characters long")
+	}
+	again, err := readSecret(c, "Type it again: ")
+	if err != nil {
+		return "", err
+	}
+	if pin != again {
+		return "", fmt.Errorf("the PINs do not match")
+	}
+	return newPinHash(pin)
+}
+
+func adminPin(c *CommandContext, args []string) error {
+	hash, err := askNewPin(c)
+	if err != nil {
+		return err
+	}
+	err = updateConfig(c.Config, func(cfg *Config) {
+		cfg.AdminPinHash = hash
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.Stdout, "The parent PIN has been changed.")
+	return nil
+}
+
+func adminLock(c *CommandContext, args []string) error {
+	c.Session.AdminUntil = time.Time{}
+	fmt.Fprintln(c.Stdout, "Admin mode is locked.")
+	return nil
+}
@@ -1,6 +1,19 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"regexp"
+)
+
+// clearScreen moves the cursor to the top left and clears the screen.
+const clearScreen = "\033[H\033[2J"
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+// stripANSI removes colors and other escape sequences from s.
+func stripANSI(s string) string {
+	return ansiEscape.ReplaceAllString(s, "")
+}
 
 func highlightRed(s string) string {
 	return fmt.Sprintf("\x1b[%dm\x1b[%dm%s\x1b[0m", 30, 101, s)
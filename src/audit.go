@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAuditLogFile     = "kidsh-audit.log"
+	defaultAuditLogMaxKB    = 1024
+	defaultAuditLogMaxFiles = 3
+)
+
+// AuditEntry is one line of the audit log: a command a child ran or tried
+// to run.
+type AuditEntry struct {
+	Time     time.Time     `json:"time"`
+	Profile  string        `json:"profile"`
+	Command  string        `json:"command"`
+	Alias    string        `json:"alias,omitempty"` // What was typed, if not Command.
+	Args     []string      `json:"args,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	Denied   bool          `json:"denied,omitempty"`
+	Stack    string        `json:"stack,omitempty"` // Where a builtin panicked.
+}
+
+// auditLogger appends entries to a JSON Lines file. When the file would
+// grow past maxSize it is renamed to file.1, file.1 to file.2 and so on,
+// keeping at most maxFiles old files.
+type auditLogger struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	size     int64
+	maxSize  int64
+	maxFiles int
+}
+
+// auditLogDirName is the directory in the state directory that a relative
+// auditLogFile is kept in. It is apart from the profiles so that the
+// sandbox can let the shell write the log without opening up anything else.
+const auditLogDirName = "audit"
+
+// resolveAuditLogFile makes a relative auditLogFile absolute, in the audit
+// directory, and creates that directory.
+func resolveAuditLogFile(cfg *Config) error {
+	if filepath.IsAbs(cfg.AuditLogFile) {
+		return nil
+	}
+	base, err := stateDir()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(base, auditLogDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	cfg.AuditLogFile = filepath.Join(dir, cfg.AuditLogFile)
+	return nil
+}
+
+// auditLog drops everything until openAuditLog is called.
+var auditLog = &auditLogger{}
+
+// openAuditLog points the audit log at the file named in cfg. It is opened
+// once at startup so that cd does not move it around.
+func openAuditLog(cfg *Config) error {
+	f, err := os.OpenFile(cfg.AuditLogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	auditLog.mu.Lock()
+	defer auditLog.mu.Unlock()
+	auditLog.path = cfg.AuditLogFile
+	auditLog.file = f
+	auditLog.size = info.Size()
+	auditLog.maxSize = int64(cfg.AuditLogMaxKB) * 1024
+	auditLog.maxFiles = cfg.AuditLogMaxFiles
+	return nil
+}
+
+// close stops writing the audit log.
+func (l *auditLogger) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// rotatedAuditLog returns the name of the nth old audit log file.
+func rotatedAuditLog(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+func (l *auditLogger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	if l.maxFiles == 0 {
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		_ = os.Remove(rotatedAuditLog(l.path, l.maxFiles))
+		for n := l.maxFiles - 1; n >= 1; n-- {
+			_ = os.Rename(rotatedAuditLog(l.path, n), rotatedAuditLog(l.path, n+1))
+		}
+		if err := os.Rename(l.path, rotatedAuditLog(l.path, 1)); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	l.file = f
+	l.size = 0
+	return nil
+}
+
+func (l *auditLogger) write(e AuditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("audit log: %v", err)
+		return
+	}
+	line = append(line, '\n')
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			log.Printf("rotate audit log: %v", err)
+			l.file = nil
+			return
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("audit log: %v", err)
+	}
+}
+
+// readAuditLog returns the entries in the audit log at path and its
+// rotated files, oldest first. Lines that aren't entries are skipped.
+func readAuditLog(path string, maxFiles int) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	for n := maxFiles; n >= 0; n-- {
+		name := path
+		if n > 0 {
+			name = rotatedAuditLog(path, n)
+		}
+		f, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Lines are read whole, however long a logged command line was.
+		r := bufio.NewReader(f)
+		for {
+			line, err := r.ReadBytes('\n')
+			var e AuditEntry
+			if len(line) > 0 && json.Unmarshal(line, &e) == nil {
+				entries = append(entries, e)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+		f.Close()
+	}
+	return entries, nil
+}
+
+func (c *CommandContext) auditEntry(command []string, d time.Duration) AuditEntry {
+	e := AuditEntry{
+		Time:     c.Clock.Now().Add(-d),
+		Profile:  c.Session.Profile,
+		Command:  command[0],
+		Args:     command[1:],
+		Duration: d,
+	}
+	if cmd, ok := cmds[command[0]]; ok && cmd.Name != command[0] {
+		e.Command, e.Alias = cmd.Name, command[0]
+	}
+	return e
+}
+
+// audit records that command ran for d, and err if it failed.
+func (c *CommandContext) audit(command []string, d time.Duration, err error) {
+	e := c.auditEntry(command, d)
+	if err != nil {
+		e.Error = err.Error()
+	}
+	var perr *panicError
+	if errors.As(err, &perr) {
+		e.Stack = string(perr.stack)
+	}
+	auditLog.write(e)
+}
+
+// auditDenied records that command was not allowed to run, and why.
+func (c *CommandContext) auditDenied(command []string, reason string) {
+	e := c.auditEntry(command, 0)
+	e.Denied = true
+	e.Error = reason
+	auditLog.write(e)
+}
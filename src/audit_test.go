@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAuditLogRotation writes more than fits in the audit log and checks
+// that old files are kept up to the limit and read back oldest first,
+// including an entry far longer than a bufio.Scanner line.
+func TestAuditLogRotation(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.AuditLogFile = filepath.Join(t.TempDir(), "audit.log")
+	cfg.AuditLogMaxKB = 1
+	cfg.AuditLogMaxFiles = 2
+	if err := openAuditLog(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(auditLog.close)
+
+	long := strings.Repeat("x", 100*1024)
+	for i := 0; i < 40; i++ {
+		args := []string{string(rune('a' + i%26))}
+		if i == 38 {
+			args = []string{long}
+		}
+		auditLog.write(AuditEntry{Time: testNow.Add(time.Duration(i) * time.Second), Profile: "kid", Command: "first", Args: args})
+	}
+
+	for _, name := range []string{cfg.AuditLogFile, rotatedAuditLog(cfg.AuditLogFile, 1), rotatedAuditLog(cfg.AuditLogFile, 2)} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("%s: %v", filepath.Base(name), err)
+		}
+	}
+	if _, err := os.Stat(rotatedAuditLog(cfg.AuditLogFile, 3)); !os.IsNotExist(err) {
+		t.Errorf("kept more than %d old audit logs", cfg.AuditLogMaxFiles)
+	}
+
+	entries, err := readAuditLog(cfg.AuditLogFile, cfg.AuditLogMaxFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 || len(entries) >= 40 {
+		t.Fatalf("read %d entries, want some but not all of 40 after rotation", len(entries))
+	}
+	for i := 1; i < len(entries); i++ {
+		if !entries[i-1].Time.Before(entries[i].Time) {
+			t.Fatalf("entries are not oldest first: %v then %v", entries[i-1].Time, entries[i].Time)
+		}
+	}
+	last := entries[len(entries)-1]
+	if !last.Time.Equal(testNow.Add(39 * time.Second)) {
+		t.Errorf("last entry is from %v, want the newest", last.Time)
+	}
+	found := false
+	for _, e := range entries {
+		if len(e.Args) == 1 && e.Args[0] == long {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("the 100 KiB entry was not read back")
+	}
+}
+
+// TestResolveAuditLogFile checks that a relative audit log goes in the
+// state directory rather than wherever the shell was started.
+func TestResolveAuditLogFile(t *testing.T) {
+	old := config
+	t.Cleanup(func() { config = old })
+	config = defaultConfig()
+	config.StateDir = t.TempDir()
+
+	cfg := defaultConfig()
+	if err := resolveAuditLogFile(cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(config.StateDir, auditLogDirName, defaultAuditLogFile)
+	if cfg.AuditLogFile != want {
+		t.Errorf("audit log is %s, want %s", cfg.AuditLogFile, want)
+	}
+	if !isDir(filepath.Dir(want)) {
+		t.Errorf("%s was not created", filepath.Dir(want))
+	}
+
+	abs := filepath.Join(t.TempDir(), "kidsh.log")
+	cfg.AuditLogFile = abs
+	if err := resolveAuditLogFile(cfg); err != nil || cfg.AuditLogFile != abs {
+		t.Errorf("an absolute audit log became %s, %v", cfg.AuditLogFile, err)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWakeHour   = 7
+	defaultWakeMinute = 0
+)
+
+// bedtimeWarnings are how many minutes before bedtime the child is warned,
+// largest first.
+var bedtimeWarnings = []int{15, 5, 1}
+
+// DaySchedule changes bedtime or wake-up time on one day of the week, such
+// as a later bedtime on Friday. Keys that are left out keep the everyday
+// values. The wake-up time is for the morning of that day.
+type DaySchedule struct {
+	BedtimeHour   *int `json:"bedtimeHour,omitempty"`
+	BedtimeMinute *int `json:"bedtimeMinute,omitempty"`
+	WakeHour      *int `json:"wakeHour,omitempty"`
+	WakeMinute    *int `json:"wakeMinute,omitempty"`
+}
+
+type clockTime struct {
+	hour, minute int
+}
+
+func (t clockTime) on(day time.Time) time.Time {
+	y, m, d := day.Date()
+	return time.Date(y, m, d, t.hour, t.minute, 0, 0, day.Location())
+}
+
+func (t clockTime) String() string {
+	return fmt.Sprintf("%02d:%02d", t.hour, t.minute)
+}
+
+func dayName(day time.Weekday) string {
+	return strings.ToLower(day.String())
+}
+
+func override(value *int, fallback int) int {
+	if value != nil {
+		return *value
+	}
+	return fallback
+}
+
+// schedule returns bedtime and wake-up time on a day of the week.
+func (c *Config) schedule(day time.Weekday) (bedtime, wake clockTime) {
+	bedtime = clockTime{c.BedtimeHour, c.BedtimeMinute}
+	wake = clockTime{c.WakeHour, c.WakeMinute}
+	if s := c.Schedule[dayName(day)]; s != nil {
+		bedtime = clockTime{override(s.BedtimeHour, bedtime.hour), override(s.BedtimeMinute, bedtime.minute)}
+		wake = clockTime{override(s.WakeHour, wake.hour), override(s.WakeMinute, wake.minute)}
+	}
+	return bedtime, wake
+}
+
+// night returns when the night that now is in started and when it ends.
+// During the day it returns the coming night.
+func (c *Config) night(now time.Time) (bedtime, wake time.Time) {
+	_, wakeToday := c.schedule(now.Weekday())
+	if now.Before(wakeToday.on(now)) {
+		yesterday := now.AddDate(0, 0, -1)
+		bedtimeYesterday, _ := c.schedule(yesterday.Weekday())
+		return bedtimeYesterday.on(yesterday), wakeToday.on(now)
+	}
+	tomorrow := now.AddDate(0, 0, 1)
+	bedtimeToday, _ := c.schedule(now.Weekday())
+	_, wakeTomorrow := c.schedule(tomorrow.Weekday())
+	return bedtimeToday.on(now), wakeTomorrow.on(tomorrow)
+}
+
+func validateClockTime(hourKey string, hour int, minuteKey string, minute int) error {
+	if hour < 0 || hour > 23 {
+		return &ConfigError{hourKey, fmt.Errorf("must be between 0 and 23, got %d", hour)}
+	}
+	if minute < 0 || minute > 59 {
+		return &ConfigError{minuteKey, fmt.Errorf("must be between 0 and 59, got %d", minute)}
+	}
+	return nil
+}
+
+func (c *Config) validateSchedule() error {
+	if err := validateClockTime("bedtimeHour", c.BedtimeHour, "bedtimeMinute", c.BedtimeMinute); err != nil {
+		return err
+	}
+	if err := validateClockTime("wakeHour", c.WakeHour, "wakeMinute", c.WakeMinute); err != nil {
+		return err
+	}
+	days := map[string]bool{}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		days[dayName(day)] = true
+	}
+	for name := range c.Schedule {
+		if !days[name] {
+			return &ConfigError{"schedule." + name, fmt.Errorf("not a day of the week")}
+		}
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		key := "schedule." + dayName(day)
+		bedtime, wake := c.schedule(day)
+		if err := validateClockTime(key+".bedtimeHour", bedtime.hour, key+".bedtimeMinute", bedtime.minute); err != nil {
+			return err
+		}
+		if err := validateClockTime(key+".wakeHour", wake.hour, key+".wakeMinute", wake.minute); err != nil {
+			return err
+		}
+		if bedtime.hour*60+bedtime.minute <= wake.hour*60+wake.minute {
+			return &ConfigError{key, fmt.Errorf("bedtime %s must be later in the day than wake-up time %s", bedtime, wake)}
+		}
+	}
+	return nil
+}
+
+// checkBedtime warns when bedtime is near and returns whether pipeline may
+// run. From bedtime until wake-up time it shows the goodnight screen
+// instead, and only admin works so that a parent can unlock the shell.
+func checkBedtime(c *CommandContext, pipeline [][]string) bool {
+	now := c.Clock.Now()
+	if c.Session.adminUnlocked(now) {
+		return true
+	}
+	bedtime, wake := c.Config.night(now)
+	if now.Before(bedtime) {
+		warnBedtime(c, bedtime.Sub(now))
+		return true
+	}
+	if len(pipeline) == 1 {
+		if cmd, ok := cmds[pipeline[0][0]]; ok && cmd.Name == adminCommand {
+			return true
+		}
+	}
+	if len(pipeline) > 0 {
+		c.auditDenied(pipeline[0], "bedtime")
+	}
+	showGoodnight(c, wake)
+	return false
+}
+
+// bedtimeDeadline returns when the shell next locks for the night, unless
+// it is already locked or a parent has unlocked it until morning.
+func bedtimeDeadline(cfg *Config, s *Session, now time.Time) (time.Time, bool) {
+	bedtime, wake := cfg.night(now)
+	if s.AdminUntil.After(bedtime) {
+		bedtime = s.AdminUntil
+	}
+	if !now.Before(bedtime) || !bedtime.Before(wake) {
+		return time.Time{}, false
+	}
+	return bedtime, true
+}
+
+// warnBedtime says how long is left once for each of bedtimeWarnings.
+func warnBedtime(c *CommandContext, left time.Duration) {
+	minutes := int(math.Ceil(left.Minutes()))
+	warning := 0
+	for _, w := range bedtimeWarnings {
+		if minutes <= w {
+			warning = w
+		}
+	}
+	if warning == 0 {
+		c.Session.BedtimeWarning = 0
+		return
+	}
+	if c.Session.BedtimeWarning != 0 && c.Session.BedtimeWarning <= warning {
+		return
+	}
+	c.Session.BedtimeWarning = warning
+	unit := "minutes"
+	if minutes == 1 {
+		unit = "minute"
+	}
+	fmt.Fprintf(c.Stdout, "%sBedtime is in %d %s. Time to finish up!%s\n", YellowText, minutes, unit, NormalText)
+}
+
+func showGoodnight(c *CommandContext, wake time.Time) {
+	name := c.myName()
+	if fields := strings.Fields(name); len(fields) > 0 {
+		name = fields[0]
+	}
+	fmt.Fprint(c.Stdout, clearScreen)
+	fmt.Fprint(c.Stdout, BlueText)
+	fmt.Fprintln(c.Stdout, "      *        .           *")
+	fmt.Fprintln(c.Stdout, "  .        *         .          .")
+	fmt.Fprintln(c.Stdout, "       .          *        *")
+	fmt.Fprintf(c.Stdout, "%s\n", NormalText)
+	fmt.Fprintf(c.Stdout, "   Goodnight, %s!\n", name)
+	fmt.Fprintln(c.Stdout, "   It's time to sleep. The computer is sleeping too.")
+	fmt.Fprintf(c.Stdout, "   See you in the morning at %s.\n\n", wake.Format("3:04 PM"))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBedtimeDeadline(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.BedtimeHour, cfg.BedtimeMinute = 20, 30
+	cfg.WakeHour, cfg.WakeMinute = 7, 0
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, time.March, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name       string
+		now        time.Time
+		adminUntil time.Time
+		want       time.Time // Zero if the shell won't lock.
+	}{
+		{"afternoon", at(14, 15, 9), time.Time{}, at(14, 20, 30)},
+		{"a minute to go", at(14, 20, 29), time.Time{}, at(14, 20, 30)},
+		{"at bedtime", at(14, 20, 30), time.Time{}, time.Time{}},
+		{"night", at(15, 3, 0), time.Time{}, time.Time{}},
+		{"unlock over", at(14, 15, 9), at(14, 14, 0), at(14, 20, 30)},
+		{"unlocked for a while", at(14, 20, 45), at(14, 21, 0), at(14, 21, 0)},
+		{"unlocked until morning", at(14, 20, 45), at(15, 8, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		s := &Session{AdminUntil: tt.adminUntil}
+		got, ok := bedtimeDeadline(cfg, s, tt.now)
+		if ok != !tt.want.IsZero() || !got.Equal(tt.want) {
+			t.Errorf("%s: bedtimeDeadline = %v, %v, want %v", tt.name, got, ok, tt.want)
+		}
+	}
+}
+
+func TestReadAnswerStopsWithCommand(t *testing.T) {
+	c, out := newTestContext(t, "4\n")
+	ctx, cancel := context.WithCancel(c.Ctx)
+	cancel()
+	c.Ctx = ctx
+	if _, err := readAnswer(c, "2 + 2 = "); err != errInterrupted {
+		t.Errorf("readAnswer after the command stopped: got %v, want errInterrupted", err)
+	}
+	if out.String() != "2 + 2 = \n" {
+		t.Errorf("output = %q", out.String())
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// The operators calc understands. Children can write × as x or *, and ÷ as
+// /.
+var calcOperators = map[rune]rune{
+	'+': '+',
+	'-': '-',
+	'−': '-',
+	'*': '*',
+	'x': '*',
+	'X': '*',
+	'×': '*',
+	'/': '/',
+	'÷': '/',
+	'(': '(',
+	')': ')',
+}
+
+// tokenizeExpression splits s into numbers, operators and parentheses.
+func tokenizeExpression(s string) ([]string, error) {
+	var tokens []string
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == ',') {
+				i++
+			}
+			text := strings.ReplaceAll(string(runes[start:i]), ",", "")
+			if strings.Count(text, ".") > 1 || text == "." {
+				return nil, fmt.Errorf("%q is not a number I know", string(runes[start:i]))
+			}
+			tokens = append(tokens, text)
+		default:
+			op, ok := calcOperators[r]
+			if !ok {
+				return nil, fmt.Errorf("I don't know what %q means in a sum", string(r))
+			}
+			tokens = append(tokens, string(op))
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// calcNode is a part of an expression: a number, or an operator and what
+// it works on. Numbers are fractions, so that 1 ÷ 3 × 3 is exactly 1.
+type calcNode interface {
+	value() (*big.Rat, error)
+}
+
+// calcNumber is a number and how it was typed, like "0.5" or "3 1/4".
+type calcNumber struct {
+	v    *big.Rat
+	text string
+}
+
+func (n calcNumber) value() (*big.Rat, error) {
+	return new(big.Rat).Set(n.v), nil
+}
+
+type calcNegate struct {
+	x calcNode
+}
+
+func (n calcNegate) value() (*big.Rat, error) {
+	x, err := n.x.value()
+	if err != nil {
+		return nil, err
+	}
+	return x.Neg(x), nil
+}
+
+type calcBinary struct {
+	op          rune
+	left, right calcNode
+}
+
+var errDivideByZero = errors.New("you can't divide by zero")
+
+func (n calcBinary) value() (*big.Rat, error) {
+	l, err := n.left.value()
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.value()
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case '+':
+		return l.Add(l, r), nil
+	case '-':
+		return l.Sub(l, r), nil
+	case '*':
+		return l.Mul(l, r), nil
+	case '/':
+		if r.Sign() == 0 {
+			return nil, errDivideByZero
+		}
+		return l.Quo(l, r), nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", n.op)
+}
+
+// calcParser is a recursive-descent parser for this grammar:
+//
+//	expression = term { ("+" | "-") term }
+//	term       = unary { ("*" | "/") unary }
+//	unary      = "-" unary | "+" unary | primary
+//	primary    = number [ number "/" number ] | "(" expression ")"
+//
+// A whole number followed by a fraction, like 3 1/4, is a mixed number.
+type calcParser struct {
+	tokens []string
+	pos    int
+}
+
+func isNumberToken(t string) bool {
+	return t != "" && (unicode.IsDigit(rune(t[0])) || t[0] == '.')
+}
+
+func (p *calcParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// parseExpression parses a whole expression like "3 + 4 * (2 - 1)".
+func parseExpression(s string) (calcNode, error) {
+	tokens, err := tokenizeExpression(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("there's no sum to work out")
+	}
+	p := &calcParser{tokens: tokens}
+	n, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		if p.peek() == ")" {
+			return nil, fmt.Errorf("there's a ) without a ( before it")
+		}
+		return nil, fmt.Errorf("I don't know what to do with %q", p.peek())
+	}
+	return n, nil
+}
+
+func (p *calcParser) expression() (calcNode, error) {
+	n, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "+" || p.peek() == "-" {
+		op := rune(p.peek()[0])
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		n = calcBinary{op, n, right}
+	}
+	return n, nil
+}
+
+func (p *calcParser) term() (calcNode, error) {
+	n, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "*" || p.peek() == "/" {
+		op := rune(p.peek()[0])
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		n = calcBinary{op, n, right}
+	}
+	return n, nil
+}
+
+func (p *calcParser) unary() (calcNode, error) {
+	switch p.peek() {
+	case "-":
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return calcNegate{x}, nil
+	case "+":
+		p.pos++
+		return p.unary()
+	}
+	return p.primary()
+}
+
+func (p *calcParser) primary() (calcNode, error) {
+	t := p.peek()
+	switch {
+	case t == "":
+		return nil, fmt.Errorf("the sum stops too soon; there needs to be a number at the end")
+	case t == "(":
+		p.pos++
+		n, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("there's a ( without a ) after it")
+		}
+		p.pos++
+		return n, nil
+	case isNumberToken(t):
+		p.pos++
+		v, err := parseNumber(t)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(t, ".") {
+			t = "0" + t
+		}
+		if p.pos+2 < len(p.tokens) && isWholeNumber(t) && p.tokens[p.pos+1] == "/" {
+			frac := p.tokens[p.pos] + "/" + p.tokens[p.pos+2]
+			if isProperFraction(frac) {
+				f, _ := parseNumber(frac)
+				p.pos += 3
+				return calcNumber{v.Add(v, f), t + " " + frac}, nil
+			}
+		}
+		return calcNumber{v, t}, nil
+	}
+	return nil, fmt.Errorf("there needs to be a number before %q", t)
+}
+
+// calcPrecedence is how tightly each operator holds on to its numbers.
+func calcPrecedence(op rune) int {
+	if op == '*' || op == '/' {
+		return 2
+	}
+	return 1
+}
+
+// formatExpression writes n out the way a child would, with × and ÷ and
+// only the parentheses that are needed.
+func formatExpression(n calcNode) string {
+	return formatNode(n, 0)
+}
+
+func formatNode(n calcNode, outer int) string {
+	switch n := n.(type) {
+	case calcNumber:
+		return n.text
+	case calcNegate:
+		return "-" + formatNode(n.x, 3)
+	case calcBinary:
+		prec := calcPrecedence(n.op)
+		op := map[rune]string{'+': "+", '-': "-", '*': "×", '/': "÷"}[n.op]
+		s := formatNode(n.left, prec) + " " + op + " " + formatNode(n.right, prec+1)
+		if prec < outer {
+			return "(" + s + ")"
+		}
+		return s
+	}
+	return "?"
+}
+
+// calcTexts returns how each number in n was typed.
+func calcTexts(n calcNode) []string {
+	switch n := n.(type) {
+	case calcNumber:
+		return []string{n.text}
+	case calcNegate:
+		return calcTexts(n.x)
+	case calcBinary:
+		return append(calcTexts(n.left), calcTexts(n.right)...)
+	}
+	return nil
+}
+
+// calculate works out expr and prints it with its answer. Dividing one
+// whole number by another gives the remainder too.
+func calculate(c *CommandContext, expr string) error {
+	n, err := parseExpression(expr)
+	if err != nil {
+		return err
+	}
+	v, err := n.value()
+	if err != nil {
+		return err
+	}
+	answer := formatRat(v, c.useDecimals(calcTexts(n)...))
+	if div, ok := n.(calcBinary); ok && div.op == '/' && !v.IsInt() {
+		l, _ := div.left.value()
+		r, _ := div.right.value()
+		if l.IsInt() && r.IsInt() && l.Sign() >= 0 && r.Sign() > 0 {
+			q, m := new(big.Int).QuoRem(l.Num(), r.Num(), new(big.Int))
+			answer = fmt.Sprintf("%s remainder %s, or %s", q, m, answer)
+		}
+	}
+	fmt.Fprintf(c.Stdout, "%s = %s%s%s\n", formatExpression(n), BoldText, answer, NormalText)
+	return nil
+}
+
+// calculatorLoop asks for sums until the child types nothing, done or
+// quit.
+func calculatorLoop(c *CommandContext) error {
+	fmt.Fprintf(c.Stdout, "Type a sum like %s3 + 4 × 2%s, or %sdone%s to stop.\n", BoldText, NormalText, BoldText, NormalText)
+	for {
+		line, err := readAnswer(c, "calc> ")
+		if err == io.EOF || err == errInterrupted {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch strings.TrimSpace(line) {
+		case "", "done", "quit", "exit":
+			return nil
+		}
+		if err := calculate(c, line); err != nil {
+			fmt.Fprintf(c.Stdout, "%sHmm, %v%s\n", YellowText, err, NormalText)
+		}
+	}
+}
+
+func doCalc(c *CommandContext, args []string) error {
+	if len(args) == 0 && c.PipedIn {
+		// Whatever is piped in is one sum, like the words after calc.
+		data, err := io.ReadAll(c.Stdin)
+		if err != nil {
+			return err
+		}
+		args = strings.Fields(string(data))
+	}
+	if len(args) > 0 {
+		return calculate(c, strings.Join(args, " "))
+	}
+	return calculatorLoop(c)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clock tells builtins what time it is. Tests use a clock that is stopped
+// at a fixed time.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// offsetClock runs at the normal speed but starts from a different time,
+// so a parent can try out what the shell does at, say, bedtime.
+type offsetClock struct {
+	offset time.Duration
+}
+
+func (c offsetClock) Now() time.Time {
+	return time.Now().Add(c.offset)
+}
+
+var nowLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// newClock returns the system clock, or if now is not empty, a clock that
+// starts at that local time, such as "2026-12-25T08:00".
+func newClock(now string) (Clock, error) {
+	if now == "" {
+		return systemClock{}, nil
+	}
+	for _, layout := range nowLayouts {
+		if t, err := time.ParseInLocation(layout, now, time.Local); err == nil {
+			return offsetClock{time.Until(t)}, nil
+		}
+	}
+	return nil, fmt.Errorf("%q is not a time like 2026-12-25T08:00", now)
+}
@@ -1,15 +1,14 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
-	"math/rand"
+	"log"
+	"math/big"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"slices"
 	"sort"
 	"strconv"
@@ -141,13 +140,10 @@ const (
 	DefaultText      = "\033[22;39m" // Normal text color and intensity
 )
 
-const stackEnv = "KIDSH_STACK"
-const queueEnv = "KIDSH_QUEUE"
-
-// TODO: Make these files a full path given by an environment variable.
-const todoFile = "todo.db"
-const contactsFile = "contacts.vcf"
-const myName = "John Doe"
+// The stack and queue can be used in commands as $KIDSH_STACK and
+// $KIDSH_QUEUE.
+const stackVar = "KIDSH_STACK"
+const queueVar = "KIDSH_QUEUE"
 
 const separator = "\x1E" // ASCII Record Separator (RS)
 
@@ -155,7 +151,8 @@ type Command struct {
 	Name        string
 	Aliases     []string
 	Description string
-	Func        func([]string) error
+	Category    string // Which screen-time budget it uses, if any.
+	Func        func(c *CommandContext, args []string) error
 }
 
 func nextCurrAndPrev(i int, options []string) (string, string, string) {
@@ -168,20 +165,20 @@ func nextCurrAndPrev(i int, options []string) (string, string, string) {
 	return options[i-1], options[i], options[i+1]
 }
 
-func doDatetime(args []string) error {
-	now := time.Now()
+func doDatetime(c *CommandContext, args []string) error {
+	now := c.Clock.Now()
 	formattedDateTime := now.Format("Monday, January 2, 2006 at 15:04:05 MST")
-	fmt.Printf("The date and time is now %s\n", formattedDateTime)
+	fmt.Fprintf(c.Stdout, "The date and time is now %s\n", formattedDateTime)
 	return nil
 }
 
-func doTime(args []string) error {
-	fmt.Print("The time is now ")
-	fmt.Println(time.Now().Format("15:04:05"))
+func doTime(c *CommandContext, args []string) error {
+	fmt.Fprint(c.Stdout, "The time is now ")
+	fmt.Fprintln(c.Stdout, c.Clock.Now().Format("15:04:05"))
 	return nil
 }
 
-func doDays(args []string) error {
+func doDays(c *CommandContext, args []string) error {
 	days := []string{
 		highlightRed("Sunday"),
 		highlightYellow("Monday"),
@@ -191,18 +188,22 @@ func doDays(args []string) error {
 		highlightMagenta("Friday"),
 		highlightWhite("Saturday"),
 	}
+	if c.PipedOut {
+		c.printList(days, "\n")
+		return nil
+	}
 	for _, day := range days {
-		fmt.Println(day)
+		fmt.Fprintln(c.Stdout, day)
 	}
-	fmt.Println()
-	yesterday, today, tomorrow := nextCurrAndPrev(int(time.Now().Weekday()), days)
-	fmt.Printf("Today is %s\n", today)
-	fmt.Printf("Yesterday was %s\n", yesterday)
-	fmt.Printf("Tomorrow is %s\n", tomorrow)
+	fmt.Fprintln(c.Stdout)
+	yesterday, today, tomorrow := nextCurrAndPrev(int(c.Clock.Now().Weekday()), days)
+	fmt.Fprintf(c.Stdout, "Today is %s\n", today)
+	fmt.Fprintf(c.Stdout, "Yesterday was %s\n", yesterday)
+	fmt.Fprintf(c.Stdout, "Tomorrow is %s\n", tomorrow)
 	return nil
 }
 
-func doMonths(args []string) error {
+func doMonths(c *CommandContext, args []string) error {
 	months := []string{
 		highlightRed("January"),
 		highlightYellow("February"),
@@ -217,62 +218,66 @@ func doMonths(args []string) error {
 		highlightBlue("November"),
 		highlightMagenta("December"),
 	}
+	if c.PipedOut {
+		c.printList(months, "\n")
+		return nil
+	}
 	for i, month := range months {
-		fmt.Printf("%d. %s\n", i+1, month)
+		fmt.Fprintf(c.Stdout, "%d. %s\n", i+1, month)
 	}
-	fmt.Println()
-	last, curr, prev := nextCurrAndPrev(int(time.Now().Month())-1, months)
-	fmt.Printf("This month is %s\n", curr)
-	fmt.Printf("Last month was %s\n", last)
-	fmt.Printf("Next month is %s\n", prev)
+	fmt.Fprintln(c.Stdout)
+	last, curr, prev := nextCurrAndPrev(int(c.Clock.Now().Month())-1, months)
+	fmt.Fprintf(c.Stdout, "This month is %s\n", curr)
+	fmt.Fprintf(c.Stdout, "Last month was %s\n", last)
+	fmt.Fprintf(c.Stdout, "Next month is %s\n", prev)
 	return nil
 }
 
-func doCal(args []string) error {
-	now := time.Now()
+func doCal(c *CommandContext, args []string) error {
+	now := c.Clock.Now()
 	year, month, day := now.Date()
 	firstDay := time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
 	firstDayWeekday := int(firstDay.Weekday())
 	daysInMonth := 32 - time.Date(year, month, 32, 0, 0, 0, 0, now.Location()).Day()
-	fmt.Printf("\n%s %d\n", month.String(), year)
-	fmt.Println("Sun Mon Tue Wed Thu Fri Sat")
+	fmt.Fprintf(c.Stdout, "\n%s %d\n", month.String(), year)
+	fmt.Fprintln(c.Stdout, "Sun Mon Tue Wed Thu Fri Sat")
 	for i := 0; i < firstDayWeekday; i++ {
-		fmt.Print("    ")
+		fmt.Fprint(c.Stdout, "    ")
 	}
 	for d := 1; d <= daysInMonth; d++ {
 		if d == day {
 			// Highlight current day with cyan
-			fmt.Printf("%s%2d%s  ", CyanText, d, NormalText)
+			fmt.Fprintf(c.Stdout, "%s%2d%s  ", CyanText, d, NormalText)
 		} else {
-			fmt.Printf("%2d  ", d)
+			fmt.Fprintf(c.Stdout, "%2d  ", d)
 		}
 
 		// Start a new line after Saturday
 		if (firstDayWeekday+d)%7 == 0 {
-			fmt.Println()
+			fmt.Fprintln(c.Stdout)
 		}
 	}
 	// Add a final newline if the last day wasn't a Saturday
 	if (firstDayWeekday+daysInMonth)%7 != 0 {
-		fmt.Println()
+		fmt.Fprintln(c.Stdout)
 	}
-	fmt.Println()
+	fmt.Fprintln(c.Stdout)
 	return nil
 }
 
-func doNews(args []string) error {
-	rssURL := os.Getenv("KIDSH_RSS_URL")
+func doNews(c *CommandContext, args []string) error {
+	rssURL := c.Config.RSSURL
 	if rssURL == "" {
-		return fmt.Errorf("KIDSH_RSS_URL environment variable not set")
+		return fmt.Errorf("no news feed is configured (rssUrl)")
 	}
 
 	fp := gofeed.NewParser()
-	feed, err := fp.ParseURL(rssURL)
+	feed, err := fp.ParseURLWithContext(rssURL, c.Ctx)
 	if err != nil {
 		return fmt.Errorf("error parsing RSS feed: %v", err)
 	}
 
-	fmt.Printf("%sLatest News from %s%s\n\n", BoldGreenText, feed.Title, NormalText)
+	fmt.Fprintf(c.Stdout, "%sLatest News from %s%s\n\n", BoldGreenText, feed.Title, NormalText)
 	
 	// Show last 5 items
 	maxItems := 5
@@ -282,77 +287,89 @@ func doNews(args []string) error {
 
 	for i := 0; i < maxItems; i++ {
 		item := feed.Items[i]
-		fmt.Printf("%s%d. %s%s\n", BoldBlueText, i+1, item.Title, NormalText)
+		fmt.Fprintf(c.Stdout, "%s%d. %s%s\n", BoldBlueText, i+1, item.Title, NormalText)
 		if item.Description != "" {
-			fmt.Printf("   %s\n", item.Description)
+			fmt.Fprintf(c.Stdout, "   %s\n", item.Description)
 		}
 		if item.Link != "" {
-			fmt.Printf("   %sLink: %s%s\n", FaintText, item.Link, NormalText)
+			fmt.Fprintf(c.Stdout, "   %sLink: %s%s\n", FaintText, item.Link, NormalText)
 		}
 		if item.Published != "" {
-			fmt.Printf("   %sPublished: %s%s\n", FaintText, item.Published, NormalText)
+			fmt.Fprintf(c.Stdout, "   %sPublished: %s%s\n", FaintText, item.Published, NormalText)
 		}
-		fmt.Println()
+		fmt.Fprintln(c.Stdout)
 	}
 
 	return nil
 }
 
-func doMsg(args []string) error {
+func doMsg(c *CommandContext, args []string) error {
 	return nil
 }
 
-func doBday(args []string) error {
+func doBday(c *CommandContext, args []string) error {
 	return nil
 }
 
-func doCalc(args []string) error {
+func doBeep(c *CommandContext, args []string) error {
+	c.Stdout.Write([]byte("Beep!\007\n"))
 	return nil
 }
 
-func doBeep(args []string) error {
-	os.Stdout.Write([]byte("Beep!\007\n"))
+func doABC(c *CommandContext, args []string) error {
+	fmt.Fprintln(c.Stdout, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	fmt.Fprintln(c.Stdout, "abcdefghijklmnopqrstuvwxyz")
 	return nil
 }
 
-func doABC(args []string) error {
-	fmt.Println("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
-	fmt.Println("abcdefghijklmnopqrstuvwxyz")
-	return nil
-}
-
-func doNum(args []string) error {
-	fmt.Println("0123456789")
-	fmt.Println()
-	fmt.Println("0 = Zero")
-	fmt.Println("1 = One")
-	fmt.Println("2 = Two")
-	fmt.Println("3 = Three")
-	fmt.Println("4 = Four")
-	fmt.Println("5 = Five")
-	fmt.Println("6 = Six")
-	fmt.Println("7 = Seven")
-	fmt.Println("8 = Eight")
-	fmt.Println("9 = Nine")
-	fmt.Println("10 = Ten")
-	fmt.Println("11 = Eleven")
-	fmt.Println("12 = Twelve")
-	fmt.Println("20 = Twenty")
-	fmt.Println("30 = Thirty")
-	fmt.Println("40 = Forty")
-	fmt.Println("50 = Fifty")
-	fmt.Println("60 = Sixty")
-	fmt.Println("70 = Seventy")
-	fmt.Println("80 = Eighty")
-	fmt.Println("90 = Ninety")
-	fmt.Println("100 = One Hundred")
+func doNum(c *CommandContext, args []string) error {
+	if len(args) > 0 && args[0] == "quiz" {
+		return numbersQuiz(c, args[1:])
+	}
+	if len(args) > 0 {
+		for i, arg := range args {
+			n, err := parseWholeNumber(arg)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				fmt.Fprintln(c.Stdout)
+			}
+			explainNumber(c, n)
+		}
+		return nil
+	}
+	fmt.Fprintln(c.Stdout, "0123456789")
+	fmt.Fprintln(c.Stdout)
+	fmt.Fprintln(c.Stdout, "0 = Zero")
+	fmt.Fprintln(c.Stdout, "1 = One")
+	fmt.Fprintln(c.Stdout, "2 = Two")
+	fmt.Fprintln(c.Stdout, "3 = Three")
+	fmt.Fprintln(c.Stdout, "4 = Four")
+	fmt.Fprintln(c.Stdout, "5 = Five")
+	fmt.Fprintln(c.Stdout, "6 = Six")
+	fmt.Fprintln(c.Stdout, "7 = Seven")
+	fmt.Fprintln(c.Stdout, "8 = Eight")
+	fmt.Fprintln(c.Stdout, "9 = Nine")
+	fmt.Fprintln(c.Stdout, "10 = Ten")
+	fmt.Fprintln(c.Stdout, "11 = Eleven")
+	fmt.Fprintln(c.Stdout, "12 = Twelve")
+	fmt.Fprintln(c.Stdout, "20 = Twenty")
+	fmt.Fprintln(c.Stdout, "30 = Thirty")
+	fmt.Fprintln(c.Stdout, "40 = Forty")
+	fmt.Fprintln(c.Stdout, "50 = Fifty")
+	fmt.Fprintln(c.Stdout, "60 = Sixty")
+	fmt.Fprintln(c.Stdout, "70 = Seventy")
+	fmt.Fprintln(c.Stdout, "80 = Eighty")
+	fmt.Fprintln(c.Stdout, "90 = Ninety")
+	fmt.Fprintln(c.Stdout, "100 = One Hundred")
 	return nil
 }
 
-func doHelp(args []string) error {
+func doHelp(c *CommandContext, args []string) error {
 	sorted := make([]*Command, 0, len(cmds))
 	for name, cmd := range cmds {
-		if name != cmd.Name {
+		if name != cmd.Name || !c.Config.commandAllowed(c.Session.Profile, cmd) {
 			continue
 		}
 		sorted = append(sorted, cmd)
@@ -360,15 +377,15 @@ func doHelp(args []string) error {
 	sort.Slice(sorted, func(i, j int) bool {
 		return sorted[i].Name < sorted[j].Name
 	})
-	fmt.Printf("%-16s    %-16s    %s\n", "NAME", "ALIASES", "DESCRIPTION")
-	fmt.Printf("%-16s    %-16s    %s\n", "====", "=======", "===========")
+	fmt.Fprintf(c.Stdout, "%-16s    %-16s    %s\n", "NAME", "ALIASES", "DESCRIPTION")
+	fmt.Fprintf(c.Stdout, "%-16s    %-16s    %s\n", "====", "=======", "===========")
 	for _, cmd := range sorted {
-		fmt.Printf("%-16s    %-16s    %s\n", cmd.Name, strings.Join(cmd.Aliases, ","), cmd.Description)
+		fmt.Fprintf(c.Stdout, "%-16s    %-16s    %s\n", cmd.Name, strings.Join(cmd.Aliases, ","), cmd.Description)
 	}
 	return nil
 }
 
-func doColors(args []string) error {
+func doColors(c *CommandContext, args []string) error {
 	red_line := highlightRed("Red")
 	yellow_line := highlightYellow("Yellow")
 	green_line := highlightGreen("Green")
@@ -377,91 +394,84 @@ func doColors(args []string) error {
 	magenta_line := highlightMagenta("Magenta")
 	grey_line := highlightGrey("Grey")
 	white_line := highlightWhite("White")
-	fmt.Println(red_line)
-	fmt.Println(yellow_line)
-	fmt.Println(green_line)
-	fmt.Println(cyan_line)
-	fmt.Println(blue_line)
-	fmt.Println(magenta_line)
-	fmt.Println(grey_line)
-	fmt.Println(white_line)
+	fmt.Fprintln(c.Stdout, red_line)
+	fmt.Fprintln(c.Stdout, yellow_line)
+	fmt.Fprintln(c.Stdout, green_line)
+	fmt.Fprintln(c.Stdout, cyan_line)
+	fmt.Fprintln(c.Stdout, blue_line)
+	fmt.Fprintln(c.Stdout, magenta_line)
+	fmt.Fprintln(c.Stdout, grey_line)
+	fmt.Fprintln(c.Stdout, white_line)
 	return nil
 }
 
-func doExit(args []string) error {
-	if len(args) != 1 {
-		os.Exit(0)
-		return nil
+func doExit(c *CommandContext, args []string) error {
+	if c.Config.ExitNeedsPin {
+		if err := unlockAdmin(c); err != nil {
+			return err
+		}
 	}
-	code, err := strconv.ParseInt(args[0], 32, 10)
-	if err != nil {
-		return err
+	code := int64(0)
+	if len(args) == 1 {
+		var err error
+		code, err = strconv.ParseInt(args[0], 32, 10)
+		if err != nil {
+			return err
+		}
+	}
+	// Save today's usage first, or typing exit would reset the budget.
+	c.Session.markActive(c.Clock.Now())
+	if err := c.Session.save(); err != nil {
+		log.Printf("save session: %v", err)
 	}
 	os.Exit(int(code))
 	return nil
 }
 
-func doDate(args []string) error {
-	fmt.Print("Today's date is ")
-	fmt.Println(time.Now().Format("Monday, January 2, 2006"))
+func doDate(c *CommandContext, args []string) error {
+	fmt.Fprint(c.Stdout, "Today's date is ")
+	fmt.Fprintln(c.Stdout, c.Clock.Now().Format("Monday, January 2, 2006"))
 	return nil
 }
 
-func doCompare(args []string) error {
-	if len(args) < 2 {
-		fmt.Println("You have to type in more than one number, silly!")
-		return nil
+func doCompare(c *CommandContext, args []string) error {
+	nums, err := parseNumbers(args)
+	if err != nil {
+		return err
 	}
-
-	// Parse all arguments as integers
-	nums := make([]int, 0, len(args))
-	for _, arg := range args {
-		num, err := strconv.Atoi(arg)
-		if err != nil {
-			return fmt.Errorf("'%s' is not a valid number", arg)
-		}
-		nums = append(nums, num)
+	if len(nums) < 2 {
+		fmt.Fprintln(c.Stdout, "You have to type in more than one number, silly!")
+		return nil
 	}
 
-	// Make a copy for sorting
-	sortedNums := make([]int, len(nums))
-	copy(sortedNums, nums)
-	sort.Ints(sortedNums)
-
 	// Special case for exactly two numbers
 	if len(nums) == 2 {
-		if nums[0] == nums[1] {
-			fmt.Printf("%d is equal to %d\n", nums[0], nums[1])
-		} else if nums[0] > nums[1] {
-			fmt.Printf("%d is larger than %d\n", nums[0], nums[1])
-		} else {
-			fmt.Printf("%d is larger than %d\n", nums[1], nums[0])
+		switch nums[0].value.Cmp(nums[1].value) {
+		case 0:
+			fmt.Fprintf(c.Stdout, "%s is equal to %s\n", nums[0].text, nums[1].text)
+		case 1:
+			fmt.Fprintf(c.Stdout, "%s is larger than %s\n", nums[0].text, nums[1].text)
+		default:
+			fmt.Fprintf(c.Stdout, "%s is larger than %s\n", nums[1].text, nums[0].text)
 		}
 		return nil
 	}
 
 	// Case for more than two numbers
-	smallest := sortedNums[0]
-	largest := sortedNums[len(sortedNums)-1]
-
-	fmt.Printf("The smallest number is %d\n", smallest)
-	fmt.Printf("The largest number is %d\n", largest)
-
-	// Print the numbers in sorted order
-	fmt.Print("Numbers in ascending order: ")
-	for i, num := range sortedNums {
-		fmt.Printf("%d", num)
-		if i < len(sortedNums)-1 {
-			fmt.Print(", ")
-		}
-	}
-	fmt.Println()
+	sortNumbers(nums)
+	fmt.Fprintf(c.Stdout, "The smallest number is %s\n", nums[0].text)
+	fmt.Fprintf(c.Stdout, "The largest number is %s\n", nums[len(nums)-1].text)
+	fmt.Fprintf(c.Stdout, "Numbers in ascending order: %s\n", strings.Join(numberTexts(nums), ", "))
 	return nil
 }
 
-func doCount(args []string) error {
+func doCount(c *CommandContext, args []string) error {
+	args, err := c.items(args)
+	if err != nil {
+		return err
+	}
 	if len(args) != 1 && (len(args) == 2 && args[0] != "to") {
-		fmt.Println("You have to tell me what number to count to, Silly!")
+		fmt.Fprintln(c.Stdout, "You have to tell me what number to count to, Silly!")
 		return nil
 	}
 	arg := args[len(args)-1]
@@ -470,51 +480,43 @@ func doCount(args []string) error {
 		return fmt.Errorf("'%s' is not a valid number", arg)
 	}
 	if num > 100 {
-		fmt.Println("That number is too big. Try a smaller number.")
+		fmt.Fprintln(c.Stdout, "That number is too big. Try a smaller number.")
 		return nil
 	}
+	numbers := make([]string, 0, num+1)
 	for i := 0; i <= num; i++ {
-		fmt.Printf("%d ", i)
+		numbers = append(numbers, strconv.Itoa(i))
 	}
-	fmt.Println()
+	c.printList(numbers, " ")
 	return nil
 }
 
-func doSortLex(args []string) error {
+func doSortLex(c *CommandContext, args []string) error {
 	sort.Strings(args)
-	for _, s := range args {
-		fmt.Printf("%s ", s)
-	}
-	fmt.Println()
+	c.printList(args, " ")
 	return nil
 }
 
-func doSort(args []string) error {
-	// Parse all arguments as integers
-	nums := make([]int, 0, len(args))
-	for _, arg := range args {
-		num, err := strconv.Atoi(arg)
-		if err != nil {
-			// If any fail, assume we want to do a lexicographic sort.
-			return doSortLex(args)
-		}
-		nums = append(nums, num)
+func doSort(c *CommandContext, args []string) error {
+	args, err := c.items(args)
+	if err != nil {
+		return err
 	}
-
-	sortedNums := make([]int, len(nums))
-	copy(sortedNums, nums)
-	sort.Ints(sortedNums)
-	for i, num := range sortedNums {
-		fmt.Printf("%d", num)
-		if i < len(sortedNums)-1 {
-			fmt.Print(", ")
-		}
+	nums, err := parseNumbers(args)
+	if err != nil {
+		// If any aren't numbers, assume we want to do a lexicographic sort.
+		return doSortLex(c, args)
 	}
-	fmt.Println()
+	sortNumbers(nums)
+	c.printList(numberTexts(nums), ", ")
 	return nil
 }
 
-func doUniq(args []string) error {
+func doUniq(c *CommandContext, args []string) error {
+	args, err := c.items(args)
+	if err != nil {
+		return err
+	}
 	if len(args) == 0 {
 		return fmt.Errorf("no arguments provided to uniq command")
 	}
@@ -526,111 +528,160 @@ func doUniq(args []string) error {
 			unique = append(unique, item)
 		}
 	}
-	fmt.Println("Unique items:")
+	if c.PipedOut {
+		c.printList(unique, "\n")
+		return nil
+	}
+	fmt.Fprintln(c.Stdout, "Unique items:")
 	for _, item := range unique {
-		fmt.Println(item)
+		fmt.Fprintln(c.Stdout, item)
 	}
-	fmt.Printf("\nFound %d unique items from %d total items\n", len(unique), len(args))
+	fmt.Fprintf(c.Stdout, "\nFound %d unique items from %d total items\n", len(unique), len(args))
 	if len(unique) < len(args) {
-		fmt.Printf("Removed %d duplicate(s)\n", len(args)-len(unique))
+		fmt.Fprintf(c.Stdout, "Removed %d duplicate(s)\n", len(args)-len(unique))
 	}
 	return nil
 }
 
-func doPwd(args []string) error {
-	dir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get current directory: %v", err)
-	}
-	fmt.Println(dir)
+func doPwd(c *CommandContext, args []string) error {
+	fmt.Fprintln(c.Stdout, c.Session.cwd())
 	return nil
 }
 
-func doCd(args []string) error {
-	if len(args) != 1 {
-		return fmt.Errorf("exactly one argument required, got %d: %q", len(args), args)
+func doCd(c *CommandContext, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("at most one argument allowed, got %d: %q", len(args), args)
 	}
-	err := os.Chdir(args[0])
+	dir := myStuff
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	virtual, host, err := c.resolve(dir)
 	if err != nil {
-		return fmt.Errorf("failed to change directory to '%s': %v", args[0], err)
+		return fmt.Errorf("failed to change directory to '%s': %v", dir, err)
+	}
+	if !isDir(host) {
+		return fmt.Errorf("failed to change directory to '%s': there is no folder called that", dir)
 	}
+	c.Session.Cwd = virtual
 	return nil
 }
 
-func doLs(args []string) error {
-	files, err := os.ReadDir(".")
+func doLs(c *CommandContext, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("at most one argument allowed, got %d: %q", len(args), args)
+	}
+	dir := "."
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	virtual, host, err := c.resolve(dir)
 	if err != nil {
 		return fmt.Errorf("failed to list directory contents: %v", err)
 	}
+	files, err := os.ReadDir(host)
+	if err != nil {
+		return fmt.Errorf("failed to list directory contents: %v", pathError(err, virtual))
+	}
 
 	for _, file := range files {
 		if file.IsDir() {
-			fmt.Printf("%s/\n", file.Name())
+			fmt.Fprintf(c.Stdout, "%s/\n", file.Name())
 		} else {
-			fmt.Println(file.Name())
+			fmt.Fprintln(c.Stdout, file.Name())
 		}
 	}
 	return nil
 }
 
-func doFirst(args []string) error {
+func doFirst(c *CommandContext, args []string) error {
+	args, err := c.items(args)
+	if err != nil {
+		return err
+	}
 	if len(args) == 0 {
-		fmt.Println("You need to supply an argument, silly!")
+		fmt.Fprintln(c.Stdout, "You need to supply an argument, silly!")
 		return nil
 	}
-	fmt.Println(args[0])
+	fmt.Fprintln(c.Stdout, args[0])
 	return nil
 }
 
-func doLast(args []string) error {
+func doLast(c *CommandContext, args []string) error {
+	args, err := c.items(args)
+	if err != nil {
+		return err
+	}
 	if len(args) == 0 {
-		fmt.Println("you need to supply an argument, silly!")
+		fmt.Fprintln(c.Stdout, "you need to supply an argument, silly!")
 		return nil
 	}
 	arg := args[len(args)-1]
-	fmt.Println(arg)
+	fmt.Fprintln(c.Stdout, arg)
 	return nil
 }
 
-func doRev(args []string) error {
-	slices.Reverse(args)
-	for _, arg := range args {
-		fmt.Printf("%s ", arg)
+func doRev(c *CommandContext, args []string) error {
+	args, err := c.items(args)
+	if err != nil {
+		return err
 	}
-	fmt.Println()
+	slices.Reverse(args)
+	c.printList(args, " ")
 	return nil
 }
 
-func doAdd(args []string) error {
-	sum := 0
-	for _, arg := range args {
-		num, err := strconv.Atoi(arg)
+func doAdd(c *CommandContext, args []string) error {
+	show, args := wantsSteps(args)
+	args, err := c.items(args)
+	if err != nil {
+		return err
+	}
+	if show {
+		nums, err := wholeNumbers(args)
 		if err != nil {
 			return err
 		}
-		sum += num
+		return showAddition(c, nums)
+	}
+	nums, err := parseNumbers(args)
+	if err != nil {
+		return err
+	}
+	sum := new(big.Rat)
+	for _, num := range nums {
+		sum.Add(sum, num.value)
 	}
-	fmt.Printf("The total is: %d\n", sum)
+	fmt.Fprintf(c.Stdout, "The total is: %s\n", formatRat(sum, c.useDecimals(args...)))
 	return nil
 }
 
-func doMultiply(args []string) error {
-	if len(args) < 1 {
-		fmt.Println("you need to supply an argument, silly!")
-		return nil
-	}
-	result, err := strconv.Atoi(args[0])
+func doMultiply(c *CommandContext, args []string) error {
+	show, args := wantsSteps(args)
+	args, err := c.items(args)
 	if err != nil {
 		return err
 	}
-	for _, arg := range args[1:] {
-		num, err := strconv.Atoi(arg)
+	if show {
+		nums, err := wholeNumbers(args)
 		if err != nil {
 			return err
 		}
-		result *= num
+		return showMultiplication(c, nums)
+	}
+	nums, err := parseNumbers(args)
+	if err != nil {
+		return err
+	}
+	if len(nums) < 1 {
+		fmt.Fprintln(c.Stdout, "you need to supply an argument, silly!")
+		return nil
 	}
-	fmt.Printf("The product is: %d\n", result)
+	result := new(big.Rat).Set(nums[0].value)
+	for _, num := range nums[1:] {
+		result.Mul(result, num.value)
+	}
+	fmt.Fprintf(c.Stdout, "The product is: %s\n", formatRat(result, c.useDecimals(args...)))
 	return nil
 }
 
@@ -638,12 +689,12 @@ const DEFAULT_WEATHER_URL = "https://wttr.in/St.%20Johns,%20Florida?format=3&u"
 
 // const DEFAULT_WEATHER_URL = "https://wttr.in/St.%20Johns,%20Florida?2Anu"
 
-func doWeather(args []string) error {
-	weatherUrl := os.Getenv("WEATHER_URL")
-	if len(weatherUrl) < 8 { // Could not be valid if smaller.
-		weatherUrl = DEFAULT_WEATHER_URL
+func doWeather(c *CommandContext, args []string) error {
+	req, err := http.NewRequestWithContext(c.Ctx, http.MethodGet, c.Config.WeatherURL, nil)
+	if err != nil {
+		return fmt.Errorf("error making request: %v", err)
 	}
-	resp, err := http.Get(weatherUrl)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("error making request: %v", err)
 	}
@@ -652,62 +703,64 @@ func doWeather(args []string) error {
 	if err != nil {
 		return fmt.Errorf("error reading response: %v", err)
 	}
-	fmt.Println(string(body))
+	fmt.Fprintln(c.Stdout, string(body))
 	return nil
 }
 
-func doUpper(args []string) error {
+func doUpper(c *CommandContext, args []string) error {
+	args, err := c.items(args)
+	if err != nil {
+		return err
+	}
+	converted := make([]string, len(args))
 	for i, arg := range args {
-		fmt.Print(strings.ToUpper(arg))
-		if i < len(args)-1 {
-			fmt.Print(" ")
-		}
+		converted[i] = strings.ToUpper(arg)
 	}
-	fmt.Println()
+	c.printList(converted, " ")
 	return nil
 }
 
-func doLower(args []string) error {
+func doLower(c *CommandContext, args []string) error {
+	args, err := c.items(args)
+	if err != nil {
+		return err
+	}
+	converted := make([]string, len(args))
 	for i, arg := range args {
-		fmt.Print(strings.ToLower(arg))
-		if i < len(args)-1 {
-			fmt.Print(" ")
-		}
+		converted[i] = strings.ToLower(arg)
 	}
-	fmt.Println()
+	c.printList(converted, " ")
 	return nil
 }
 
-func doEnv(args []string) error {
+func doEnv(c *CommandContext, args []string) error {
 	envVars := os.Environ()
 	sort.Strings(envVars)
 	for _, env := range envVars {
-		fmt.Println(env)
+		fmt.Fprintln(c.Stdout, env)
 	}
 	return nil
 }
 
-func doShuffle(args []string) error {
+func doShuffle(c *CommandContext, args []string) error {
+	args, err := c.items(args)
+	if err != nil {
+		return err
+	}
 	shuffled := make([]string, len(args))
 	copy(shuffled, args)
 
 	// Fisher-Yates shuffle algorithm
 	for i := len(shuffled) - 1; i > 0; i-- {
-		j := time.Now().UnixNano() % int64(i+1)
-		shuffled[i], shuffled[int(j)] = shuffled[int(j)], shuffled[i]
+		j := c.Rand.Intn(i + 1)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
 	}
 
-	for i, arg := range shuffled {
-		fmt.Print(arg)
-		if i < len(shuffled)-1 {
-			fmt.Print(" ")
-		}
-	}
-	fmt.Println()
+	c.printList(shuffled, " ")
 	return nil
 }
 
-func doRandom(args []string) error {
+func doRandom(c *CommandContext, args []string) error {
 	max := 100 // Default max value
 
 	// If an argument is provided, use it as the max value
@@ -723,24 +776,26 @@ func doRandom(args []string) error {
 	}
 
 	// Generate random number between 0 and max
-	source := time.Now().UnixNano()
-	randomNum := int(source % int64(max+1))
+	randomNum := c.Rand.Intn(max + 1)
 
-	fmt.Printf("Random number (0-%d): %d\n", max, randomNum)
+	if c.PipedOut {
+		fmt.Fprintln(c.Stdout, randomNum)
+		return nil
+	}
+	fmt.Fprintf(c.Stdout, "Random number (0-%d): %d\n", max, randomNum)
 	return nil
 }
 
-func doFlip(args []string) error {
-	source := time.Now().UnixNano()
+func doFlip(c *CommandContext, args []string) error {
 	result := "Tails"
-	if source%2 == 0 {
+	if c.Rand.Intn(2) == 0 {
 		result = "Heads"
 	}
-	fmt.Printf("The coin flip result is: %s\n", result)
+	fmt.Fprintf(c.Stdout, "The coin flip result is: %s\n", result)
 	return nil
 }
 
-func doSleep(args []string) error {
+func doSleep(c *CommandContext, args []string) error {
 	// Default sleep time is 1 second
 	sleepTime := 1.0
 
@@ -761,57 +816,56 @@ func doSleep(args []string) error {
 	if duration > (10 * time.Second) {
 		return fmt.Errorf("that's too long")
 	}
-	time.Sleep(duration)
-	return nil
+	return c.sleep(duration)
 }
 
-func doReset(args []string) error {
+func doReset(c *CommandContext, args []string) error {
 	// ANSI escape sequence to reset the terminal
 	resetSequence := "\033c"
-	fmt.Print(resetSequence)
+	fmt.Fprint(c.Stdout, resetSequence)
 	return nil
 }
 
-func doCompass(args []string) error {
-	fmt.Println("   NW   N    NE  ")
-	fmt.Println("        |        ")
-	fmt.Println("   W ---+--- E   ")
-	fmt.Println("        |        ")
-	fmt.Println("   SW   S    SE  ")
-	fmt.Println()
-	fmt.Println("N = North")
-	fmt.Println("E = East")
-	fmt.Println("S = South")
-	fmt.Println("W = West")
-	fmt.Println()
-	fmt.Println("NE = Northeast")
-	fmt.Println("SE = Southeast")
-	fmt.Println("SW = Southwest")
-	fmt.Println("NW = Northwest")
+func doCompass(c *CommandContext, args []string) error {
+	fmt.Fprintln(c.Stdout, "   NW   N    NE  ")
+	fmt.Fprintln(c.Stdout, "        |        ")
+	fmt.Fprintln(c.Stdout, "   W ---+--- E   ")
+	fmt.Fprintln(c.Stdout, "        |        ")
+	fmt.Fprintln(c.Stdout, "   SW   S    SE  ")
+	fmt.Fprintln(c.Stdout)
+	fmt.Fprintln(c.Stdout, "N = North")
+	fmt.Fprintln(c.Stdout, "E = East")
+	fmt.Fprintln(c.Stdout, "S = South")
+	fmt.Fprintln(c.Stdout, "W = West")
+	fmt.Fprintln(c.Stdout)
+	fmt.Fprintln(c.Stdout, "NE = Northeast")
+	fmt.Fprintln(c.Stdout, "SE = Southeast")
+	fmt.Fprintln(c.Stdout, "SW = Southwest")
+	fmt.Fprintln(c.Stdout, "NW = Northwest")
 	return nil
 }
 
-func doIp(args []string) error {
+func doIp(c *CommandContext, args []string) error {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
 		return fmt.Errorf("failed to get interface addresses: %v", err)
 	}
-	fmt.Println("My IP Addresses:")
+	fmt.Fprintln(c.Stdout, "My IP Addresses:")
 	for _, addr := range addrs {
 		// Check if this is an IP network address
 		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
 			// Show IPv4 addresses
 			if ipnet.IP.To4() != nil {
-				fmt.Printf("  %s\n", ipnet.IP.String())
+				fmt.Fprintf(c.Stdout, "  %s\n", ipnet.IP.String())
 			} else if ipnet.IP.To16() != nil {
-				fmt.Printf("  %s\n", ipnet.IP.String())
+				fmt.Fprintf(c.Stdout, "  %s\n", ipnet.IP.String())
 			}
 		}
 	}
 	return nil
 }
 
-func doSeasons(args []string) error {
+func doSeasons(c *CommandContext, args []string) error {
 	// Define emoji and colors for each season
 	spring := fmt.Sprintf("\033[42;37m Spring \033[0m") // Green background, white text
 	summer := fmt.Sprintf("\033[43;30m Summer \033[0m") // Yellow background, black text
@@ -819,7 +873,7 @@ func doSeasons(args []string) error {
 	winter := fmt.Sprintf("\033[44;37m Winter \033[0m") // Blue background, white text
 
 	// Get current season in Northern Hemisphere
-	now := time.Now()
+	now := c.Clock.Now()
 	month := now.Month()
 	var currentSeason string
 
@@ -834,24 +888,24 @@ func doSeasons(args []string) error {
 		currentSeason = winter
 	}
 
-	fmt.Printf("Current season (Northern Hemisphere): %s\n", currentSeason)
-	fmt.Println("The Four Seasons:")
-	fmt.Println(spring)
-	fmt.Println("  - March, April, May (Northern Hemisphere)")
-	fmt.Println("  - September, October, November (Southern Hemisphere)")
-	fmt.Println(summer)
-	fmt.Println("  - June, July, August (Northern Hemisphere)")
-	fmt.Println("  - December, January, February (Southern Hemisphere)")
-	fmt.Println(autumn)
-	fmt.Println("  - September, October, November (Northern Hemisphere)")
-	fmt.Println("  - March, April, May (Southern Hemisphere)")
-	fmt.Println(winter)
-	fmt.Println("  - December, January, February (Northern Hemisphere)")
-	fmt.Println("  - June, July, August (Southern Hemisphere)")
+	fmt.Fprintf(c.Stdout, "Current season (Northern Hemisphere): %s\n", currentSeason)
+	fmt.Fprintln(c.Stdout, "The Four Seasons:")
+	fmt.Fprintln(c.Stdout, spring)
+	fmt.Fprintln(c.Stdout, "  - March, April, May (Northern Hemisphere)")
+	fmt.Fprintln(c.Stdout, "  - September, October, November (Southern Hemisphere)")
+	fmt.Fprintln(c.Stdout, summer)
+	fmt.Fprintln(c.Stdout, "  - June, July, August (Northern Hemisphere)")
+	fmt.Fprintln(c.Stdout, "  - December, January, February (Southern Hemisphere)")
+	fmt.Fprintln(c.Stdout, autumn)
+	fmt.Fprintln(c.Stdout, "  - September, October, November (Northern Hemisphere)")
+	fmt.Fprintln(c.Stdout, "  - March, April, May (Southern Hemisphere)")
+	fmt.Fprintln(c.Stdout, winter)
+	fmt.Fprintln(c.Stdout, "  - December, January, February (Northern Hemisphere)")
+	fmt.Fprintln(c.Stdout, "  - June, July, August (Southern Hemisphere)")
 	return nil
 }
 
-func doUptime(args []string) error {
+func doUptime(c *CommandContext, args []string) error {
 	// Read uptime info from /proc/uptime on Linux
 	data, err := os.ReadFile("/proc/uptime")
 	if err != nil {
@@ -875,141 +929,103 @@ func doUptime(args []string) error {
 	minutes := int((uptimeSeconds - float64(days)*86400 - float64(hours)*3600) / 60)
 	seconds := int(uptimeSeconds - float64(days)*86400 - float64(hours)*3600 - float64(minutes)*60)
 
-	fmt.Print("System uptime: ")
+	fmt.Fprint(c.Stdout, "System uptime: ")
 	if days > 0 {
-		fmt.Printf("%d day(s), ", days)
+		fmt.Fprintf(c.Stdout, "%d day(s), ", days)
 	}
-	fmt.Printf("%02d:%02d:%02d\n", hours, minutes, seconds)
+	fmt.Fprintf(c.Stdout, "%02d:%02d:%02d\n", hours, minutes, seconds)
 
 	// Get current time
-	now := time.Now()
-	fmt.Printf("Current time: %s\n", now.Format("15:04:05"))
+	now := c.Clock.Now()
+	fmt.Fprintf(c.Stdout, "Current time: %s\n", now.Format("15:04:05"))
 
 	return nil
 }
 
-func doPush(args []string) error {
+func doPush(c *CommandContext, args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("no values provided to push")
 	}
-
-	current := os.Getenv(stackEnv)
-	newEntries := strings.Join(args, separator)
-
-	var newStack string
-	if current == "" {
-		newStack = newEntries
-	} else {
-		newStack = current + separator + newEntries
-	}
-
-	return os.Setenv(stackEnv, newStack)
+	c.Session.Stack = append(c.Session.Stack, args...)
+	return nil
 }
 
-func doPop(args []string) error {
-	current := os.Getenv(stackEnv)
-	if current == "" {
-		return fmt.Errorf("stack is empty")
-	}
-
-	parts := strings.Split(current, separator)
-	if len(parts) == 0 {
+func doPop(c *CommandContext, args []string) error {
+	stack := c.Session.Stack
+	if len(stack) == 0 {
 		return fmt.Errorf("stack is empty")
 	}
-
-	popped := parts[len(parts)-1]
-	remaining := parts[:len(parts)-1]
-
-	if len(remaining) == 0 {
-		_ = os.Unsetenv(stackEnv)
-	} else {
-		_ = os.Setenv(stackEnv, strings.Join(remaining, separator))
-	}
-
-	fmt.Println(popped)
+	popped := stack[len(stack)-1]
+	c.Session.Stack = stack[:len(stack)-1]
+	fmt.Fprintln(c.Stdout, popped)
 	return nil
 }
 
-func doPrintStack(args []string) error {
-	current := os.Getenv(stackEnv)
-	if current == "" {
-		fmt.Println("Stack is empty.")
+func doPrintStack(c *CommandContext, args []string) error {
+	if len(c.Session.Stack) == 0 {
+		fmt.Fprintln(c.Stdout, "Stack is empty.")
 		return nil
 	}
 
-	parts := strings.Split(current, separator)
+	if c.PipedOut {
+		c.printList(c.Session.Stack, "\n")
+		return nil
+	}
 
 	// A few readable ANSI foreground colors (30–37, skipping black)
 	colors := []int{31, 32, 33, 34, 35, 36, 37}
 
-	for i, val := range parts {
+	for i, val := range c.Session.Stack {
 		color := colors[i%len(colors)]
-		fmt.Printf("\033[%dm[%d] %s\033[0m\n", color, i, val)
+		fmt.Fprintf(c.Stdout, "\033[%dm[%d] %s\033[0m\n", color, i, val)
 	}
 	return nil
 }
 
-func doEnqueue(args []string) error {
+func doEnqueue(c *CommandContext, args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("no values provided to enqueue")
 	}
-
-	current := os.Getenv(queueEnv)
-	newEntries := strings.Join(args, separator)
-
-	var newQueue string
-	if current == "" {
-		newQueue = newEntries
-	} else {
-		newQueue = current + separator + newEntries
-	}
-
-	return os.Setenv("KIDSH_QUEUE", newQueue)
+	c.Session.Queue = append(c.Session.Queue, args...)
+	return nil
 }
 
-func doDequeue(args []string) error {
-	current := os.Getenv(queueEnv)
-	if current == "" {
-		return fmt.Errorf("queue is empty")
-	}
-
-	parts := strings.Split(current, separator)
-	if len(parts) == 0 {
+func doDequeue(c *CommandContext, args []string) error {
+	queue := c.Session.Queue
+	if len(queue) == 0 {
 		return fmt.Errorf("queue is empty")
 	}
-
-	dequeued := parts[0]
-	remaining := parts[1:]
-
-	if len(remaining) == 0 {
-		_ = os.Unsetenv(queueEnv)
-	} else {
-		_ = os.Setenv(queueEnv, strings.Join(remaining, separator))
-	}
-
-	fmt.Println(dequeued)
+	dequeued := queue[0]
+	c.Session.Queue = queue[1:]
+	fmt.Fprintln(c.Stdout, dequeued)
 	return nil
 }
 
-func doPrintQueue(args []string) error {
-	current := os.Getenv(queueEnv)
-	if current == "" {
-		fmt.Println("Queue is empty.")
+func doPrintQueue(c *CommandContext, args []string) error {
+	if len(c.Session.Queue) == 0 {
+		fmt.Fprintln(c.Stdout, "Queue is empty.")
+		return nil
+	}
+	if c.PipedOut {
+		c.printList(c.Session.Queue, "\n")
 		return nil
 	}
 
-	parts := strings.Split(current, separator)
 	colors := []int{31, 32, 33, 34, 35, 36, 37}
 
-	for i, val := range parts {
+	for i, val := range c.Session.Queue {
 		color := colors[i%len(colors)]
-		fmt.Printf("\033[%dm[%d] %s\033[0m\n", color, i, val)
+		fmt.Fprintf(c.Stdout, "\033[%dm[%d] %s\033[0m\n", color, i, val)
 	}
 	return nil
 }
 
-func readTodos() ([]string, error) {
-	data, err := os.ReadFile(todoFile)
+func readTodos(c *CommandContext) ([]string, error) {
+	path, err := c.Session.todoPath(c.Config.TodoFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
 	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
@@ -1019,43 +1035,56 @@ func readTodos() ([]string, error) {
 	return strings.Split(string(data), separator), nil
 }
 
-func writeTodos(todos []string) error {
+func writeTodos(c *CommandContext, todos []string) error {
+	path, err := c.Session.todoPath(c.Config.TodoFile)
+	if err != nil {
+		return err
+	}
 	if len(todos) == 0 {
-		return os.Remove(todoFile)
+		return os.Remove(path)
 	}
-	return os.WriteFile(todoFile, []byte(strings.Join(todos, separator)), 0644)
+	return os.WriteFile(path, []byte(strings.Join(todos, separator)), 0644)
 }
 
-func doTodo(args []string) error {
-	todos, err := readTodos()
+func doTodo(c *CommandContext, args []string) error {
+	todos, err := readTodos(c)
 	if err != nil {
 		return err
 	}
 
 	if len(args) == 0 {
 		if len(todos) == 0 {
-			fmt.Println("No todos.")
+			// Nothing for the next command to work on, so don't pass it the message.
+			if c.PipedOut {
+				fmt.Fprintln(c.Stderr, "No todos.")
+				return nil
+			}
+			fmt.Fprintln(c.Stdout, "No todos.")
+			return nil
+		}
+		if c.PipedOut {
+			c.printList(todos, "\n")
 			return nil
 		}
 		colors := []int{31, 32, 33, 34, 35, 36, 37}
 		for i, val := range todos {
 			color := colors[i%len(colors)]
-			fmt.Printf("\033[%dm[%d] %s\033[0m\n", color, i, val)
+			fmt.Fprintf(c.Stdout, "\033[%dm[%d] %s\033[0m\n", color, i, val)
 		}
 		return nil
 	}
 
 	newItem := strings.Join(args, " ")
 	todos = append(todos, newItem)
-	return writeTodos(todos)
+	return writeTodos(c, todos)
 }
 
-func doDone(args []string) error {
+func doDone(c *CommandContext, args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("specify index or prefix to mark done")
 	}
 
-	todos, err := readTodos()
+	todos, err := readTodos(c)
 	if err != nil {
 		return err
 	}
@@ -1086,16 +1115,16 @@ func doDone(args []string) error {
 
 	done := todos[idx]
 	todos = append(todos[:idx], todos[idx+1:]...)
-	if err := writeTodos(todos); err != nil {
+	if err := writeTodos(c, todos); err != nil {
 		return err
 	}
 
-	fmt.Printf("Done: %s\n", done)
+	fmt.Fprintf(c.Stdout, "Done: %s\n", done)
 	return nil
 }
 
-func doHomeAddress(args []string) error {
-	f, err := os.Open(contactsFile)
+func doHomeAddress(c *CommandContext, args []string) error {
+	f, err := os.Open(c.Config.ContactsVCFFile)
 	if err != nil {
 		return err
 	}
@@ -1111,7 +1140,7 @@ func doHomeAddress(args []string) error {
 			return err
 		}
 
-		if fn := card.PreferredValue(vcard.FieldFormattedName); fn == myName {
+		if fn := card.PreferredValue(vcard.FieldFormattedName); fn == c.myName() {
 			addresses := card[vcard.FieldAddress]
 			for _, a := range addresses {
 				if strings.Contains(strings.ToLower(a.Params.Get("TYPE")), "home") {
@@ -1125,8 +1154,12 @@ func doHomeAddress(args []string) error {
 						"Postal Code",
 						"Country",
 					}
+					// Some cards leave the empty fields off the end.
+					for len(parts) < len(labels) {
+						parts = append(parts, "")
+					}
 
-					fmt.Printf("%sMy home address is:%s\n", BoldGreenText, NormalText)
+					fmt.Fprintf(c.Stdout, "%sMy home address is:%s\n", BoldGreenText, NormalText)
 					lines := []string{}
 					if parts[0] != "" {
 						lines = append(lines, parts[0]) // PO Box
@@ -1145,10 +1178,10 @@ func doHomeAddress(args []string) error {
 						lines = append(lines, parts[6]) // Country
 					}
 					for _, l := range lines {
-						fmt.Println(l)
+						fmt.Fprintln(c.Stdout, l)
 					}
 
-					fmt.Printf("\n%sFormatted Address Fields:%s\n", BoldGreenText, NormalText)
+					fmt.Fprintf(c.Stdout, "\n%sFormatted Address Fields:%s\n", BoldGreenText, NormalText)
 					maxLabelLen := 0
 					for _, label := range labels {
 						if len(label) > maxLabelLen {
@@ -1157,22 +1190,22 @@ func doHomeAddress(args []string) error {
 					}
 					for i := 0; i < len(parts) && i < len(labels); i++ {
 						if parts[i] != "" {
-							fmt.Printf("%-*s: %s\n", maxLabelLen, labels[i], parts[i])
+							fmt.Fprintf(c.Stdout, "%-*s: %s\n", maxLabelLen, labels[i], parts[i])
 						}
 					}
 
 					return nil
 				}
 			}
-			return fmt.Errorf("home address not found for %s", myName)
+			return fmt.Errorf("home address not found for %s", c.myName())
 		}
 	}
 
-	return fmt.Errorf("contact not found: %s", myName)
+	return fmt.Errorf("contact not found: %s", c.myName())
 }
 
-func doBirthday(args []string) error {
-	f, err := os.Open(contactsFile)
+func doBirthday(c *CommandContext, args []string) error {
+	f, err := os.Open(c.Config.ContactsVCFFile)
 	if err != nil {
 		return err
 	}
@@ -1188,10 +1221,10 @@ func doBirthday(args []string) error {
 			return err
 		}
 
-		if fn := card.PreferredValue(vcard.FieldFormattedName); fn == myName {
+		if fn := card.PreferredValue(vcard.FieldFormattedName); fn == c.myName() {
 			bdayRaw := card.PreferredValue(vcard.FieldBirthday)
 			if bdayRaw == "" {
-				return fmt.Errorf("birthday not found for %s", myName)
+				return fmt.Errorf("birthday not found for %s", c.myName())
 			}
 
 			var bday time.Time
@@ -1208,14 +1241,14 @@ func doBirthday(args []string) error {
 			}
 
 			if parsed {
-				fmt.Printf("My birthday is: %s\n", bday.Format("January 2, 2006"))
+				fmt.Fprintf(c.Stdout, "My birthday is: %s\n", bday.Format("January 2, 2006"))
 
-				now := time.Now()
+				now := c.Clock.Now()
 				if bday.Month() == now.Month() && bday.Day() == now.Day() {
-					fmt.Println("Today is your birthday! Yay!")
+					fmt.Fprintln(c.Stdout, "Today is your birthday! Yay!")
 				}
 			} else {
-				fmt.Printf("My birthday is: %s\n", bdayRaw)
+				fmt.Fprintf(c.Stdout, "My birthday is: %s\n", bdayRaw)
 			}
 
 			return nil
@@ -1224,11 +1257,11 @@ func doBirthday(args []string) error {
 
 	// TODO: Print out birthdays of family members
 
-	return fmt.Errorf("contact not found: %s", myName)
+	return fmt.Errorf("contact not found: %s", c.myName())
 }
 
-func doAge(args []string) error {
-	f, err := os.Open(contactsFile)
+func doAge(c *CommandContext, args []string) error {
+	f, err := os.Open(c.Config.ContactsVCFFile)
 	if err != nil {
 		return err
 	}
@@ -1244,10 +1277,10 @@ func doAge(args []string) error {
 			return err
 		}
 
-		if fn := card.PreferredValue(vcard.FieldFormattedName); fn == myName {
+		if fn := card.PreferredValue(vcard.FieldFormattedName); fn == c.myName() {
 			bdayRaw := card.PreferredValue(vcard.FieldBirthday)
 			if bdayRaw == "" {
-				return fmt.Errorf("birthday not found for %s", myName)
+				return fmt.Errorf("birthday not found for %s", c.myName())
 			}
 
 			bday, err := time.Parse("2006-01-02", bdayRaw)
@@ -1255,21 +1288,21 @@ func doAge(args []string) error {
 				return fmt.Errorf("could not parse birthday: %s", bdayRaw)
 			}
 
-			now := time.Now()
+			now := c.Clock.Now()
 			age := now.Year() - bday.Year()
 			if now.Month() < bday.Month() || (now.Month() == bday.Month() && now.Day() < bday.Day()) {
 				age-- // hasn't had birthday yet this year
 			}
 
-			fmt.Printf("My age is: %d\n", age)
+			fmt.Fprintf(c.Stdout, "My age is: %d\n", age)
 			return nil
 		}
 	}
 
-	return fmt.Errorf("contact not found: %s", myName)
+	return fmt.Errorf("contact not found: %s", c.myName())
 }
 
-func doCountdown(args []string) error {
+func doCountdown(c *CommandContext, args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("please provide a starting number")
 	}
@@ -1286,24 +1319,27 @@ func doCountdown(args []string) error {
 
 	for i := start; i >= 0; i-- {
 		// ANSI: clear line (\033[2K) and return carriage (\r)
-		fmt.Fprintf(os.Stdout, "\033[2K\r%d", i)
-		time.Sleep(1 * time.Second)
+		fmt.Fprintf(c.Stdout, "\033[2K\r%d", i)
+		if err := c.sleep(1 * time.Second); err != nil {
+			fmt.Fprintln(c.Stdout)
+			return err
+		}
 	}
-	fmt.Fprintf(os.Stdout, "\033[2K\rGo!\n")
+	fmt.Fprintf(c.Stdout, "\033[2K\rGo!\n")
 	return nil
 }
 
-func doNock(args []string) error {
+func doNock(c *CommandContext, args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("please provide a Nock expression")
 	}
 	src := strings.Join(args, " ")
 	expr := nock.Parse(src)
-	fmt.Println(expr.String())
+	fmt.Fprintln(c.Stdout, expr.String())
 	return nil
 }
 
-func doRepeat(args []string) error {
+func doRepeat(c *CommandContext, args []string) error {
 	if len(args) < 2 {
 		return fmt.Errorf("usage: repeat <count> <text...>")
 	}
@@ -1315,35 +1351,74 @@ func doRepeat(args []string) error {
 
 	line := strings.Join(args[1:], " ")
 	for i := 0; i < count; i++ {
-		fmt.Println(line)
+		fmt.Fprintln(c.Stdout, line)
 	}
 	return nil
 }
 
-func doSubtract(args []string) error {
-	if len(args) < 2 {
+func doSubtract(c *CommandContext, args []string) error {
+	show, args := wantsSteps(args)
+	if show {
+		nums, err := wholeNumbers(args)
+		if err != nil {
+			return err
+		}
+		return showSubtraction(c, nums)
+	}
+	nums, err := parseNumbers(args)
+	if err != nil {
+		return err
+	}
+	if len(nums) != 2 {
 		return fmt.Errorf("please provide two numbers: minuend subtrahend")
 	}
 
-	a, err1 := strconv.Atoi(args[0])
-	b, err2 := strconv.Atoi(args[1])
-	if err1 != nil || err2 != nil {
-		return fmt.Errorf("both arguments must be integers")
+	difference := new(big.Rat).Sub(nums[0].value, nums[1].value)
+	fmt.Fprintln(c.Stdout, formatRat(difference, c.useDecimals(args...)))
+	return nil
+}
+
+func doDivide(c *CommandContext, args []string) error {
+	show, args := wantsSteps(args)
+	if show {
+		nums, err := wholeNumbers(args)
+		if err != nil {
+			return err
+		}
+		return showDivision(c, nums)
+	}
+	nums, err := parseNumbers(args)
+	if err != nil {
+		return err
+	}
+	if len(nums) != 2 {
+		return fmt.Errorf("please provide two numbers: dividend divisor")
+	}
+	a, b := nums[0].value, nums[1].value
+	if b.Sign() == 0 {
+		return errDivideByZero
 	}
 
-	fmt.Println(a - b)
+	quotient := new(big.Rat).Quo(a, b)
+	answer := formatRat(quotient, c.useDecimals(args...))
+	if a.IsInt() && b.IsInt() && a.Sign() >= 0 && b.Sign() > 0 && !quotient.IsInt() {
+		q, r := new(big.Int).QuoRem(a.Num(), b.Num(), new(big.Int))
+		answer = fmt.Sprintf("%s remainder %s, or %s", q, r, answer)
+	}
+	fmt.Fprintf(c.Stdout, "%s ÷ %s = %s\n", nums[0].text, nums[1].text, answer)
 	return nil
 }
 
-func doCountGame(args []string) error {
-	count := rand.Intn(9) + 1 // 1–9
+func doCountGame(c *CommandContext, args []string) error {
+	count := c.Rand.Intn(9) + 1 // 1–9
 
 	// TODO: Format to be a little more readable
-	fmt.Println(strings.Repeat("O", count))
+	fmt.Fprintln(c.Stdout, strings.Repeat("O", count))
 
-	fmt.Print("How many Os? ")
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+	input, err := readAnswer(c, "How many Os? ")
+	if err == errInterrupted {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("failed to read input: %v", err)
 	}
@@ -1351,15 +1426,15 @@ func doCountGame(args []string) error {
 	input = strings.TrimSpace(input)
 	n, err := strconv.Atoi(input)
 	if err != nil {
-		fmt.Println("Please enter a number.")
+		fmt.Fprintln(c.Stdout, "Please enter a number.")
 		return nil
 	}
 
 	// TODO: color
 	if n == count {
-		fmt.Println("That's correct!")
+		fmt.Fprintln(c.Stdout, "That's correct!")
 	} else {
-		fmt.Println("That is incorrect.")
+		fmt.Fprintln(c.Stdout, "That is incorrect.")
 	}
 	return nil
 }
@@ -1388,26 +1463,34 @@ func isTextFile(data []byte) bool {
 	return float64(printableCount)/float64(checkLen) > 0.8
 }
 
-func doCat(args []string) error {
+func doCat(c *CommandContext, args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("please specify a file to display")
 	}
 
-	filename := args[0]
-	data, err := os.ReadFile(filename)
+	virtual, filename, err := c.resolve(args[0])
 	if err != nil {
 		return fmt.Errorf("error reading file: %v", err)
 	}
+	return printTextFile(c, filename, virtual)
+}
+
+// printTextFile prints the file at path, calling it name in errors.
+func printTextFile(c *CommandContext, path, name string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading file: %v", pathError(err, name))
+	}
 
 	if !isTextFile(data) {
 		return fmt.Errorf("warning: this appears to be a binary file. Use a different tool to view it.")
 	}
 
-	fmt.Print(string(data))
+	fmt.Fprint(c.Stdout, string(data))
 	return nil
 }
 
-func doAnd(args []string) error {
+func doAnd(c *CommandContext, args []string) error {
 	if len(args) != 2 {
 		return fmt.Errorf("and requires exactly 2 operands")
 	}
@@ -1416,11 +1499,11 @@ func doAnd(args []string) error {
 	op2 := isTruthy(args[1])
 	
 	result := op1 && op2
-	fmt.Printf("%s AND %s = %s\n", args[0], args[1], boolToStr(result))
+	fmt.Fprintf(c.Stdout, "%s AND %s = %s\n", args[0], args[1], boolToStr(result))
 	return nil
 }
 
-func doOr(args []string) error {
+func doOr(c *CommandContext, args []string) error {
 	if len(args) != 2 {
 		return fmt.Errorf("or requires exactly 2 operands")
 	}
@@ -1429,11 +1512,11 @@ func doOr(args []string) error {
 	op2 := isTruthy(args[1])
 	
 	result := op1 || op2
-	fmt.Printf("%s OR %s = %s\n", args[0], args[1], boolToStr(result))
+	fmt.Fprintf(c.Stdout, "%s OR %s = %s\n", args[0], args[1], boolToStr(result))
 	return nil
 }
 
-func doXor(args []string) error {
+func doXor(c *CommandContext, args []string) error {
 	if len(args) != 2 {
 		return fmt.Errorf("xor requires exactly 2 operands")
 	}
@@ -1442,11 +1525,11 @@ func doXor(args []string) error {
 	op2 := isTruthy(args[1])
 	
 	result := op1 != op2
-	fmt.Printf("%s XOR %s = %s\n", args[0], args[1], boolToStr(result))
+	fmt.Fprintf(c.Stdout, "%s XOR %s = %s\n", args[0], args[1], boolToStr(result))
 	return nil
 }
 
-func doNot(args []string) error {
+func doNot(c *CommandContext, args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("not requires exactly 1 operand")
 	}
@@ -1454,7 +1537,7 @@ func doNot(args []string) error {
 	op := isTruthy(args[0])
 	result := !op
 	
-	fmt.Printf("NOT %s = %s\n", args[0], boolToStr(result))
+	fmt.Fprintf(c.Stdout, "NOT %s = %s\n", args[0], boolToStr(result))
 	return nil
 }
 
@@ -1470,30 +1553,33 @@ func boolToStr(b bool) string {
 	return "false"
 }
 
-func doFamily(args []string) error {
-	return doCat([]string{"family.txt"})
+func doFamily(c *CommandContext, args []string) error {
+	return printTextFile(c, c.Config.FamilyInfoFile, c.Config.FamilyInfoFile)
 }
 
-func doBedtime(args []string) error {
-	now := time.Now()
-	// FIXME: get bedtime from config
-	bedtime := time.Date(now.Year(), now.Month(), now.Day(), 21, 0, 0, 0, now.Location())
-	
-	// If it's already past bedtime, show tomorrow's bedtime
-	if now.After(bedtime) {
-		bedtime = bedtime.Add(24 * time.Hour)
+func doBedtime(c *CommandContext, args []string) error {
+	now := c.Clock.Now()
+	bedtime, wake := c.Config.night(now)
+	if !now.Before(bedtime) {
+		fmt.Fprintf(c.Stdout, "It's bedtime! Wake-up time is at %s\n", wake.Format("3:04 PM"))
+		return nil
 	}
 	
 	timeUntilBedtime := bedtime.Sub(now)
 	hours := int(timeUntilBedtime.Hours())
 	minutes := int(timeUntilBedtime.Minutes()) % 60
 	
-	fmt.Printf("Bedtime is at %s\n", bedtime.Format("3:04 PM"))
-	fmt.Printf("Time until bedtime: %d hours and %d minutes\n", hours, minutes)
+	fmt.Fprintf(c.Stdout, "Bedtime is at %s\n", bedtime.Format("3:04 PM"))
+	fmt.Fprintf(c.Stdout, "Time until bedtime: %d hours and %d minutes\n", hours, minutes)
+	fmt.Fprintf(c.Stdout, "Wake-up time is at %s\n", wake.Format("3:04 PM"))
 	return nil
 }
 
-func doPrintOut(args []string) error {
+func doPrintOut(c *CommandContext, args []string) error {
+	args, err := c.items(args)
+	if err != nil {
+		return err
+	}
 	if len(args) == 0 {
 		return fmt.Errorf("printOut requires at least one argument")
 	}
@@ -1502,37 +1588,41 @@ func doPrintOut(args []string) error {
 	text := strings.Join(args, " ")
 	
 	// Create command to pipe to lpr
-	cmd := exec.Command("lpr")
+	cmd, ok := programCommand(c, "lpr")
+	if !ok {
+		return fmt.Errorf("the printer is not turned on for kidsh")
+	}
 	cmd.Stdin = strings.NewReader(text)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
 	
 	return cmd.Run()
 }
 
-func doSpeak(args []string) error {
+func doSpeak(c *CommandContext, args []string) error {
+	args, err := c.items(args)
+	if err != nil {
+		return err
+	}
 	if len(args) == 0 {
 		return fmt.Errorf("speak requires at least one argument")
 	}
 	
-	// Check if espeak is available
-	_, err := exec.LookPath("espeak")
-	if err != nil {
-		return fmt.Errorf("espeak command not found: %v", err)
-	}
-	
 	// Concatenate all arguments with spaces
 	text := strings.Join(args, " ")
 	
 	// Create command to invoke espeak
-	cmd := exec.Command("espeak", text)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd, ok := programCommand(c, "espeak", text)
+	if !ok {
+		return fmt.Errorf("speaking is not turned on for kidsh")
+	}
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
 	
 	return cmd.Run()
 }
 
-func doBible(args []string) error {
+func doBible(c *CommandContext, args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("bible requires at least one argument")
 	}
@@ -1545,7 +1635,11 @@ func doBible(args []string) error {
 	}
 	
 	// Make the request
-	resp, err := client.Get("https://bible-api.com/" + query)
+	req, err := http.NewRequestWithContext(c.Ctx, http.MethodGet, "https://bible-api.com/"+query, nil)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to make request: %v", err)
 	}
@@ -1567,9 +1661,9 @@ func doBible(args []string) error {
 	}
 
 	for _, verse := range bibleResponse.Verses {
-		fmt.Printf("%s %d:%d\n", verse.BookName, verse.Chapter, verse.Verse)
-		fmt.Println(verse.Text)
-		fmt.Println()
+		fmt.Fprintf(c.Stdout, "%s %d:%d\n", verse.BookName, verse.Chapter, verse.Verse)
+		fmt.Fprintln(c.Stdout, verse.Text)
+		fmt.Fprintln(c.Stdout)
 	}
 	
 	return nil
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testNow is a Friday afternoon.
+var testNow = time.Date(2025, time.March, 14, 15, 9, 26, 0, time.UTC)
+
+const testPin = "1234"
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// tickingClock moves on each time it is read, a second more each time,
+// so that answers take different times.
+type tickingClock struct {
+	now  time.Time
+	step time.Duration
+}
+
+func (c *tickingClock) Now() time.Time {
+	c.step += time.Second
+	c.now = c.now.Add(c.step)
+	return c.now
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	config = defaultConfig()
+	os.Exit(m.Run())
+}
+
+// newTestContext returns a context whose output goes to the returned
+// buffer, with the clock stopped at testNow and a seeded RNG.
+func newTestContext(t *testing.T, stdin string) (*CommandContext, *bytes.Buffer) {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.ContactsVCFFile = filepath.Join("..", "contacts.vcf")
+	cfg.FamilyInfoFile = filepath.Join("testdata", "family.txt")
+	cfg.AdminPinHash = hashPin(testPin, []byte("salt"))
+	var out bytes.Buffer
+	c := &CommandContext{
+		Ctx:     context.Background(),
+		Config:  cfg,
+		Session: &Session{Profile: defaultProfile, Dir: t.TempDir()},
+		Clock:   fixedClock(testNow),
+		Rand:    rand.New(rand.NewSource(1)),
+		Stdin:   strings.NewReader(stdin),
+		Stdout:  &out,
+		Stderr:  &out,
+	}
+	if err := c.Session.openJail(); err != nil {
+		t.Fatal(err)
+	}
+	return c, &out
+}
+
+type goldenCase struct {
+	name  string
+	lines []string // Command lines run in order in the same session.
+	stdin string
+	ansi  bool      // Keep ANSI escape codes in the output.
+	now   time.Time // The time to run at, if not testNow.
+	setup func(c *CommandContext)
+}
+
+var goldenCases = []goldenCase{
+	{name: "time", lines: []string{"time"}},
+	{name: "date", lines: []string{"date"}},
+	{name: "datetime", lines: []string{"datetime"}},
+	{name: "colors", lines: []string{"colors"}, ansi: true},
+	{name: "days", lines: []string{"days"}, ansi: true},
+	{name: "months", lines: []string{"months"}, ansi: true},
+	{name: "calendar", lines: []string{"calendar"}, ansi: true},
+	{name: "message", lines: []string{"message hi"}},
+	{name: "birthdays", lines: []string{"birthdays"}},
+	{name: "calculator", lines: []string{"calculator 1 + 1", "calc 3 + 4 * (2 - 1)", "calc (3 + 4) x 2", "calc 7 / 2", "calc 8 ÷ 2", "calc 1 / 3", "calc 0.1 + 0.2", "calc -3 - -5", "calc 10 - (2 - 3)", "calc -(2 + 2) * 1,000", "calc 5 / (3 - 3)", "calc 2 +", "calc (1 + 2", "calc 1 + 2)", "calc 3 apples", "calc 1 / 3 * 3", "calc 3 1/4 + 1/2", "calc 0.5 + 1/4", "calc 99999999999999999999 + 1"}},
+	{name: "calculator_loop", lines: []string{"calc", "uppercase 6 x 7 | calc"}, stdin: "2 * 3\n7 / 0\n\n"},
+	{name: "alphabet", lines: []string{"alphabet"}},
+	{name: "beep", lines: []string{"beep"}},
+	{name: "help", lines: []string{"help"}},
+	{name: "numbers", lines: []string{"numbers"}},
+	{name: "numbers_explain", lines: []string{"numbers 4372", "numbers 0", "numbers -15", "numbers 1,002,003,004,015", "numbers 3999 4000", "numbers 999999999999999", "numbers 1000000000000000", "numbers seven"}},
+	{name: "drill", lines: []string{"drill", "drill times", "drill stats", "drill divide"}, stdin: "4\n5\neight\n8\n6\n9\n12\n1\ndone\n", setup: func(c *CommandContext) {
+		c.Clock = &tickingClock{now: testNow}
+		c.Config.Drill = map[string]*DrillRange{"multiply": {Min: 2, Max: 4}}
+		c.Config.DrillQuestions = 4
+	}},
+	{name: "drill_skip", lines: []string{"drill stats", "drill"}, stdin: "\n4\ndone\n", setup: func(c *CommandContext) {
+		c.Config.Drill = map[string]*DrillRange{"multiply": {Min: 2, Max: 2}}
+		os.WriteFile(c.Session.drillPath(), []byte(`{"2 × 2": {"box": 9, "wrong": 1}, "2 × 3": {"box": -1}, "3 × 2": null}`), 0600)
+	}},
+	{name: "numbers_quiz", lines: []string{"numbers quiz 7"}, stdin: "7\n1\nnine hundred and ninety nine\n1\nXIII\n6,843\n"},
+	{name: "compare_two", lines: []string{"compare 2 5"}},
+	{name: "compare_many", lines: []string{"compare 3 10 -1 7"}},
+	{name: "compare_fractions", lines: []string{"compare 1/2 0.5", "compare 2/3 3/4", "compare 1 1/2 1.25 5/4"}},
+	{name: "count", lines: []string{"count to 5"}},
+	{name: "sort_numbers", lines: []string{"sort 10 3 7"}},
+	{name: "sort_fractions", lines: []string{"sort 1/2 0.25 3 1/4 1 -2"}},
+	{name: "sort_words", lines: []string{"sort pear apple fig"}},
+	{name: "unique", lines: []string{"unique a b a c b"}},
+	{name: "first", lines: []string{"first a b c"}},
+	{name: "last", lines: []string{"last a b c"}},
+	{name: "reverse", lines: []string{"reverse a b c"}},
+	{name: "add", lines: []string{"add 1 2 3"}},
+	{name: "add_fractions", lines: []string{"add 1/2 1/4", "add 3 1/4 2 1/2", "add 0.25 0.5", "add 99999999999999999999 1", "add 1/0", "add three"}},
+	{name: "add_show", lines: []string{"add show 478 356 29", "add explain 999 1", "add show 1.5 2"}},
+	{name: "multiply", lines: []string{"multiply 2 3 4"}},
+	{name: "multiply_fractions", lines: []string{"multiply 1/2 2/3", "multiply \"3 1/4\" 2", "multiply 4294967296 4294967296"}},
+	{name: "multiply_show", lines: []string{"multiply show 7", "multiply show 47 23", "multiply show 36 4"}},
+	{name: "lowercase", lines: []string{"lowercase HELLO There"}},
+	{name: "uppercase", lines: []string{"uppercase hello there"}},
+	{name: "shuffle", lines: []string{"shuffle a b c d e"}},
+	{name: "random", lines: []string{"random 10"}},
+	{name: "cointoss", lines: []string{"cointoss"}},
+	{name: "sleep", lines: []string{"sleep 0"}},
+	{name: "compass", lines: []string{"compass"}},
+	{name: "reset", lines: []string{"reset"}, ansi: true},
+	{name: "seasons", lines: []string{"seasons"}},
+	{name: "stack", lines: []string{"stack", "push a b", "push c", "stack", "pop", "pop", "stack"}},
+	{name: "queue", lines: []string{"queue", "enqueue a b", "enqueue c", "queue", "dequeue", "queue"}},
+	{name: "todo", lines: []string{"todo", `todo "feed the cat"`, "todo clean my room", "todo", "done 0", "done clean", "todo"}},
+	{name: "todo_empty_pipe", lines: []string{"todo | sort", "todo | uppercase"}},
+	{name: "notes", lines: []string{"notes", "note I like cats", "n -color blue my bike is blue", "note -color pink oops", "note remember the milk", "notes", "notes read 2", "notes search CAT", "notes search dogs", "notes | uppercase", "notes delete 1", "notes delete 7", "notes"}, ansi: true},
+	{name: "home", lines: []string{"home"}},
+	{name: "home_short_address", lines: []string{"home"}, setup: writeShortAddress},
+	{name: "birthday", lines: []string{"birthday"}},
+	{name: "age", lines: []string{"age"}},
+	{name: "countdown", lines: []string{"countdown 0"}},
+	{name: "nock", lines: []string{"nock [42 [0 1]]"}},
+	{name: "repeat", lines: []string{"repeat 3 hip hip hooray"}},
+	{name: "subtract", lines: []string{"subtract 10 4"}},
+	{name: "subtract_fractions", lines: []string{"subtract 1 1/3", "subtract 1/4 3/4", "subtract 2.5 0.75"}},
+	{name: "fractions", lines: []string{"fractions", "fractions decimals", "add 1/2 1/3", "divide 1 8", "fractions mixed", "add 0.5 0.25", "calc 7 / 2", "fractions auto", "fractions", "fractions halves"}},
+	{name: "subtract_show", lines: []string{"subtract show 503 78", "subtract show 1000 1", "subtract show 3 7"}},
+	{name: "divide", lines: []string{"divide 7 2", "divide 8 2", "divide 1 0"}},
+	{name: "divide_show", lines: []string{"divide show 1024 6", "divide show 987 3", "divide show 3 7"}},
+	{name: "countgame", lines: []string{"countgame"}, stdin: "6\n"},
+	{name: "read", lines: []string{"read story.txt", `read "/My Stuff/story.txt"`}, setup: writeTestFiles},
+	{name: "files", lines: []string{"pwd", "list", "cd drawings", "pwd", "list", "cd ..", "cd ../..", "cd /", "pwd", "list", "cd", "pwd", "list /", "cd /etc", "read ../../etc/passwd", "read nothing.txt", "read /escape/passwd", "cd /escape", "read dangling", "cd story.txt/x", "list story.txt/x", "read story.txt/x", "cd " + strings.Repeat("a", 300), "todo hello", "list /"}, setup: writeTestFiles},
+	{name: "and", lines: []string{"and true false"}},
+	{name: "or", lines: []string{"or true false"}},
+	{name: "xor", lines: []string{"xor true true"}},
+	{name: "not", lines: []string{"not 0"}},
+	{name: "family", lines: []string{"family"}},
+	{name: "bedtime", lines: []string{"bedtime"}},
+	{name: "bedtime_warning", lines: []string{"time", "time", "bedtime"}, now: time.Date(2025, time.March, 14, 20, 46, 0, 0, time.UTC)},
+	{name: "goodnight", lines: []string{"bedtime", "colors | first", "admin", "time"}, stdin: testPin + "\n", now: time.Date(2025, time.March, 15, 6, 30, 0, 0, time.UTC)},
+	{name: "printout", lines: []string{"printout hello"}},
+	{name: "speak", lines: []string{"speak hello"}},
+	{name: "admin", lines: []string{"admin", "admin", "admin lock", "admin bogus"}, stdin: "0000\n" + testPin + "\n"},
+	{name: "timeleft", lines: []string{"timeleft"}},
+	{name: "budgets", lines: []string{"timeleft", "cointoss", "cointoss", "cointoss", "timeleft"}, setup: func(c *CommandContext) {
+		c.Config.ScreenTimeMinutes = 60
+		c.Config.CategoryMinutes = map[string]int{categoryGames: 30}
+		c.Config.CommandRuns = map[string]int{"cointoss": 2}
+		c.Session.Usage = &Usage{Date: "2025-03-14", Active: 45 * time.Minute, Categories: map[string]time.Duration{categoryGames: 12 * time.Minute}}
+	}},
+	{name: "budget_used_up", lines: []string{"countgame", "time", "timeleft"}, setup: func(c *CommandContext) {
+		c.Config.ScreenTimeMinutes = 60
+		c.Config.CategoryMinutes = map[string]int{categoryGames: 30}
+		c.Session.Usage = &Usage{Date: "2025-03-14", Active: 40 * time.Minute, Categories: map[string]time.Duration{categoryGames: 30 * time.Minute}}
+	}},
+	{name: "denied", lines: []string{"colors", "rm -rf /", "days | first", "admin history"}, stdin: testPin + "\n", setup: func(c *CommandContext) {
+		c.Config.DisabledCommands = []string{"colors"}
+		c.Config.AuditLogFile = filepath.Join(c.Session.Dir, "audit.log")
+		if err := openAuditLog(c.Config); err != nil {
+			panic(err)
+		}
+	}},
+	{name: "admin_history", lines: []string{"admin history", "admin history -day yesterday", "admin history -command dt", "admin history -day today -command countgame -n 1", "admin history -n 0", "admin history -n -1"}, stdin: testPin + "\n", setup: writeTestAuditLog},
+	{name: "pipeline", lines: []string{"reverse c b a | uppercase | first"}},
+	{name: "pipeline_one_item", lines: []string{`todo "wash the dog"`, "todo | first", "todo | sort", "todo | sort | first", "todo | uppercase", `push "feed the cat"`, "stack | last", "days | shuffle | first", "count to 3 | add"}},
+}
+
+// notGolden lists the commands that have no golden test, and why.
+var notGolden = map[string]string{
+	"news":        "needs the network",
+	"weather":     "needs the network",
+	"bible":       "needs the network",
+	"ipaddresses": "depends on the host",
+	"uptime":      "depends on the host",
+	"environment": "depends on the host",
+	"protections": "depends on the host",
+	"exit":        "exits the test",
+	"edit":        "needs a terminal",
+}
+
+// writeTestFiles puts a story and a drawing in My Stuff, and links that
+// lead out of the jail at the top.
+func writeTestFiles(c *CommandContext) {
+	stuff := filepath.Join(c.Session.jailRoot(), "My Stuff")
+	must := func(err error) {
+		if err != nil {
+			panic(err)
+		}
+	}
+	must(os.WriteFile(filepath.Join(stuff, "story.txt"), []byte("Once upon a time.\n"), 0644))
+	must(os.Mkdir(filepath.Join(stuff, "drawings"), 0755))
+	must(os.WriteFile(filepath.Join(stuff, "drawings", "cat.txt"), []byte("=^.^=\n"), 0644))
+	must(os.Symlink("/etc", filepath.Join(c.Session.jailRoot(), "escape")))
+	must(os.Symlink("/nowhere", filepath.Join(stuff, "dangling")))
+}
+
+// writeShortAddress gives the child a home address that leaves off the
+// postal code and country.
+func writeShortAddress(c *CommandContext) {
+	c.Config.ContactsVCFFile = filepath.Join(c.Session.Dir, "contacts.vcf")
+	card := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:John Doe\r\nADR;TYPE=home:;;123 Maple St;Springfield\r\nEND:VCARD\r\n"
+	if err := os.WriteFile(c.Config.ContactsVCFFile, []byte(card), 0644); err != nil {
+		panic(err)
+	}
+}
+
+// writeTestAuditLog fills a fresh audit log with a day and a half of use.
+func writeTestAuditLog(c *CommandContext) {
+	c.Config.AuditLogFile = filepath.Join(c.Session.Dir, "audit.log")
+	if err := openAuditLog(c.Config); err != nil {
+		panic(err)
+	}
+	entry := func(ago time.Duration, command ...string) AuditEntry {
+		e := c.auditEntry(command, 0)
+		e.Time = testNow.Add(-ago)
+		return e
+	}
+	e := entry(26*time.Hour, "countgame")
+	e.Duration = 95 * time.Second
+	auditLog.write(e)
+	auditLog.write(entry(25*time.Hour, "dt"))
+	e = entry(2*time.Hour, "colors")
+	e.Denied, e.Error = true, "turned off"
+	auditLog.write(e)
+	auditLog.write(entry(time.Hour, "datetime"))
+	e = entry(30*time.Minute, "countgame")
+	e.Error = "EOF"
+	auditLog.write(e)
+	auditLog.write(entry(20*time.Minute, "countgame"))
+}
+
+// runLines runs each command line through the shell, with c as its
+// settings and session, and returns what it printed, including the errors
+// it logged.
+func runLines(t *testing.T, c *CommandContext, out *bytes.Buffer, lines []string) string {
+	t.Helper()
+	oldConfig, oldSession, oldClock, oldRandom := config, session, clock, random
+	oldInput, oldOutput, oldErrors := commandInput, commandOutput, commandErrors
+	t.Cleanup(func() {
+		config, session, clock, random = oldConfig, oldSession, oldClock, oldRandom
+		commandInput, commandOutput, commandErrors = oldInput, oldOutput, oldErrors
+		log.SetOutput(os.Stderr)
+		nonzeroExit = false
+	})
+	config, session, clock, random = c.Config, c.Session, c.Clock, c.Rand
+	commandInput, commandOutput, commandErrors = c.Stdin, out, out
+	log.SetOutput(out)
+	for _, line := range lines {
+		executeLine(line)
+	}
+	return out.String()
+}
+
+func TestGolden(t *testing.T) {
+	for _, tc := range goldenCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, out := newTestContext(t, tc.stdin)
+			t.Cleanup(auditLog.close)
+			if !tc.now.IsZero() {
+				c.Clock = fixedClock(tc.now)
+			}
+			if tc.setup != nil {
+				tc.setup(c)
+			}
+			got := runLines(t, c, out, tc.lines)
+			if !tc.ansi {
+				got = stripANSI(got)
+			}
+			path := filepath.Join("testdata", tc.name+".golden")
+			if *update {
+				if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("output of %q does not match %s\ngot:\n%s\nwant:\n%s", tc.lines, path, got, want)
+			}
+		})
+	}
+}
+
+func TestBuiltinPanic(t *testing.T) {
+	c, out := newTestContext(t, "")
+	broken := &Command{Name: "broken", Func: func(c *CommandContext, args []string) error {
+		return fmt.Errorf("no %s", args[0])
+	}}
+	err := runBuiltin(c, broken, nil)
+	perr, ok := err.(*panicError)
+	if !ok {
+		t.Fatalf("got error %v, want a panic", err)
+	}
+	if !bytes.Contains(perr.stack, []byte("TestBuiltinPanic")) {
+		t.Errorf("stack does not say where the panic was:\n%s", perr.stack)
+	}
+	if got := stripANSI(out.String()); !strings.HasPrefix(got, "Oops, something went wrong with broken.") {
+		t.Errorf("got %q, want an oops message", got)
+	}
+}
+
+// TestExecuteLinePanic checks that a builtin that panics is caught, so the
+// next line still runs.
+func TestExecuteLinePanic(t *testing.T) {
+	cmds["broken"] = &Command{Name: "broken", Func: func(c *CommandContext, args []string) error {
+		return fmt.Errorf("no %s", args[0])
+	}}
+	t.Cleanup(func() { delete(cmds, "broken") })
+	c, out := newTestContext(t, "")
+	got := stripANSI(runLines(t, c, out, []string{"broken", "days | first"}))
+	if !strings.HasPrefix(got, "Oops, something went wrong with broken.") || !strings.HasSuffix(got, "Sunday\n") {
+		t.Errorf("got %q, want an oops message and then Sunday", got)
+	}
+	if !nonzeroExit {
+		t.Error("a panic did not make the shell exit with an error")
+	}
+}
+
+// TestAdminResetsOtherProfilesTodos clears bob's and carol's todo lists
+// while alice is using the shell.
+func TestAdminResetsOtherProfilesTodos(t *testing.T) {
+	c, out := newTestContext(t, testPin+"\n")
+	c.Config.StateDir = t.TempDir()
+	c.Config.Profiles = map[string]*Profile{"alice": {}, "bob": {}, "carol": {}}
+	c.Session.Profile = "alice"
+	bob := &Session{Profile: "bob", Dir: filepath.Join(c.Config.StateDir, "profiles", "bob")}
+	if err := bob.openJail(); err != nil {
+		t.Fatal(err)
+	}
+	todo, err := bob.todoPath(c.Config.TodoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(todo, []byte("feed the cat\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Carol has never used the shell, so there is nothing to clear.
+	got := runLines(t, c, out, []string{"admin todos bob", "admin todos carol"})
+	if !strings.Contains(got, "Cleared the todo list of bob.") || !strings.Contains(got, "Cleared the todo list of carol.") {
+		t.Errorf("got %q, want bob's and carol's todo lists cleared", got)
+	}
+	if _, err := os.Stat(todo); !os.IsNotExist(err) {
+		t.Errorf("bob's todo list is still there: %v", err)
+	}
+}
+
+func TestEditor(t *testing.T) {
+	e := &editor{cols: 11, rows: 10, paras: [][]rune{{}}}
+	for _, key := range []string{"t", "h", "e", " ", "q", "u", "i", "c", "k", " ", "b", "r", "o", "w", "n", " ", "f", "o", "x", " ", "j", "u", "m", "p", "s", "\033[A", "\r", "\033[A", "\033[F", "!"} {
+		if _, err := e.handle(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, l := range e.lines() {
+		got = append(got, string(e.paras[l.para][l.start:l.end]))
+	}
+	want := []string{"the quick ", "brown!", " fox jumps"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got lines %q, want %q", got, want)
+	}
+	if starts := wrapParagraph([]rune("abcdefghijklmnop"), 10); len(starts) != 2 || starts[1] != 10 {
+		t.Errorf("a long word wrapped at %v, want [0 10]", starts)
+	}
+}
+
+// TestGoldenCoverage makes sure every command has a golden test or a
+// reason not to.
+func TestGoldenCoverage(t *testing.T) {
+	tested := map[*Command]bool{}
+	for _, tc := range goldenCases {
+		for _, line := range tc.lines {
+			pipeline, _ := parsePipeline(line, os.Getenv)
+			for _, command := range pipeline {
+				tested[cmds[command[0]]] = true
+			}
+		}
+	}
+	for name, cmd := range cmds {
+		if name != cmd.Name || tested[cmd] {
+			continue
+		}
+		if _, ok := notGolden[name]; !ok {
+			t.Errorf("command %q has no golden test", name)
+		}
+	}
+}
+
+// TestExitSavesSession runs exit in a child process, since it ends the
+// process, and checks that the time used so far was saved.
+func TestExitSavesSession(t *testing.T) {
+	if dir := os.Getenv("KIDSH_TEST_EXIT_DIR"); dir != "" {
+		c, _ := newTestContext(t, "")
+		c.Session.Dir = dir
+		c.Session.LastActive = testNow.Add(-time.Minute)
+		doExit(c, nil)
+		t.Fatal("exit returned")
+	}
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExitSavesSession$")
+	cmd.Env = append(os.Environ(), "KIDSH_TEST_EXIT_DIR="+dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, sessionFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Usage == nil || s.Usage.Active != time.Minute {
+		t.Errorf("saved usage is %+v, want a minute of screen time", s.Usage)
+	}
+}
@@ -1,33 +1,182 @@
 package main
 
-import "os"
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
+const configFileName = "config.json"
+
+const defaultTodoFile = "todo.db"
+
 type Config struct {
-	rssUrl string
-	contactsVcfFile string
-	familyInfoFile string
-	bedtimeHour int
-	bedtimeMinute int
+	RSSURL          string `json:"rssUrl"`
+	ContactsVCFFile string `json:"contactsVcfFile"`
+	FamilyInfoFile  string `json:"familyInfoFile"`
+	BedtimeHour     int    `json:"bedtimeHour"`
+	BedtimeMinute   int    `json:"bedtimeMinute"`
+
+	// WakeHour and WakeMinute end the bedtime lockout in the morning.
+	WakeHour   int `json:"wakeHour"`
+	WakeMinute int `json:"wakeMinute"`
+
+	// Schedule changes bedtime or wake-up time on some days of the week,
+	// by lower-case day name like "friday".
+	Schedule map[string]*DaySchedule `json:"schedule"`
+
+	// MyName is the formatted name (FN) of the child's own vCard in
+	// ContactsVCFFile, unless their profile says otherwise.
+	MyName string `json:"myName"`
+
+	// TodoFile is a path inside the child's own files.
+	TodoFile   string `json:"todoFile"`
+	WeatherURL string `json:"weatherUrl"`
+
+	// AllowedPrograms lists the absolute paths of the external programs the
+	// shell may run in strict mode, such as /usr/bin/lpr.
+	AllowedPrograms []string `json:"allowedPrograms"`
+	AuditLogFile    string   `json:"auditLogFile"`
+
+	// The audit log is rotated when it reaches AuditLogMaxKB, keeping
+	// AuditLogMaxFiles old logs.
+	AuditLogMaxKB    int `json:"auditLogMaxKB"`
+	AuditLogMaxFiles int `json:"auditLogMaxFiles"`
+
+	// StateDir is where history and other saved state lives. It defaults to
+	// $XDG_STATE_HOME/kidsh.
+	StateDir string `json:"stateDir"`
+
+	// Profiles are the children who use the shell, by the name they pick
+	// when they log in. Each gets their own state directory.
+	Profiles map[string]*Profile `json:"profiles"`
+
+	// DisabledCommands are turned off for every profile.
+	DisabledCommands []string `json:"disabledCommands"`
+
+	// AdminPinHash is the salted hash of the parent PIN that unlocks the
+	// admin command. Set it with kidsh -set-pin.
+	AdminPinHash        string `json:"adminPinHash"`
+	AdminTimeoutMinutes int    `json:"adminTimeoutMinutes"`
+
+	// ExitNeedsPin makes exit ask for the parent PIN, so that a child
+	// can't leave the shell for whatever started it.
+	ExitNeedsPin bool `json:"exitNeedsPin"`
+
+	// ScreenTimeMinutes limits how long the shell is used each day, and
+	// CategoryMinutes how long is spent on each category of commands, like
+	// {"games": 30}. Zero or missing means no limit. CommandRuns limits how
+	// many times a command may be run each day, like {"countgame": 5}.
+	ScreenTimeMinutes int            `json:"screenTimeMinutes"`
+	CategoryMinutes   map[string]int `json:"categoryMinutes"`
+	CommandRuns       map[string]int `json:"commandRuns"`
+
+	// Drill is which math facts drill asks about, by kind, like
+	// {"multiply": {"min": 2, "max": 12}}. Kinds that are left out aren't
+	// asked. DrillQuestions is how many facts are asked each time.
+	Drill          map[string]*DrillRange `json:"drill"`
+	DrillQuestions int                    `json:"drillQuestions"`
+
+	// RunAsUser is the account the shell switches to if it is started as
+	// root. Limits are resource limits, and Sandbox turns on Landlock and
+	// seccomp where the kernel has them.
+	RunAsUser string `json:"runAsUser"`
+	Limits    Limits `json:"limits"`
+	Sandbox   bool   `json:"sandbox"`
+}
+
+// ConfigError reports a problem with a single configuration key.
+type ConfigError struct {
+	Key string
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("config: %s: %v", e.Key, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		ContactsVCFFile: "contacts.vcf",
+		FamilyInfoFile:  "family.txt",
+		BedtimeHour:     21,
+		WakeHour:        defaultWakeHour,
+		WakeMinute:      defaultWakeMinute,
+		MyName:          "John Doe",
+		TodoFile:        defaultTodoFile,
+		WeatherURL:      DEFAULT_WEATHER_URL,
+		AuditLogFile:    defaultAuditLogFile,
+
+		AuditLogMaxKB:    defaultAuditLogMaxKB,
+		AuditLogMaxFiles: defaultAuditLogMaxFiles,
+
+		AdminTimeoutMinutes: defaultAdminTimeoutMinutes,
+		DrillQuestions:      defaultDrillQuestions,
+
+		Limits:  Limits{FileSizeMB: defaultFileSizeMB, OpenFiles: defaultOpenFiles},
+		Sandbox: true,
+	}
 }
 
 func (c *Config) ToJSON() ([]byte, error) {
-	return json.Marshal(c)
+	return json.MarshalIndent(c, "", "  ")
 }
 
 func (c *Config) FromJSON(data []byte) error {
-	return json.Unmarshal(data, c)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(c)
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &typeErr):
+		return &ConfigError{typeErr.Field, fmt.Errorf("expected %s, got %s", typeErr.Type, typeErr.Value)}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		key, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		return &ConfigError{key, fmt.Errorf("unknown key")}
+	}
+	return err
 }
 
+// SaveToFile writes the config to filename, readable only by its owner
+// since it holds the parent PIN hash. It is written to a temporary file
+// first and moved into place, so a crash can't leave it half written.
 func (c *Config) SaveToFile(filename string) error {
 	data, err := c.ToJSON()
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %v", err)
 	}
-	return os.WriteFile(filename, data, 0644)
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
 }
 
 func (c *Config) LoadFromFile(filename string) error {
@@ -35,11 +184,166 @@ func (c *Config) LoadFromFile(filename string) error {
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %v", err)
 	}
-	return c.FromJSON(data)
+	if err := c.FromJSON(data); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
 }
 
-func getConfig() *Config {
-	return &Config{
-		Queue: os.Getenv("KIDSH_QUEUE"),
+// configEnvOverrides maps environment variables onto the config keys they
+// replace. They are applied after the config file is loaded.
+var configEnvOverrides = []struct {
+	env   string
+	key   string
+	apply func(c *Config, value string) error
+}{
+	{"KIDSH_RSS_URL", "rssUrl", func(c *Config, v string) error { c.RSSURL = v; return nil }},
+	{"KIDSH_CONTACTS_FILE", "contactsVcfFile", func(c *Config, v string) error { c.ContactsVCFFile = v; return nil }},
+	{"KIDSH_FAMILY_FILE", "familyInfoFile", func(c *Config, v string) error { c.FamilyInfoFile = v; return nil }},
+	{"KIDSH_BEDTIME", "bedtimeHour", func(c *Config, v string) error {
+		hour, minute, err := parseClockTime(v)
+		c.BedtimeHour, c.BedtimeMinute = hour, minute
+		return err
+	}},
+	{"KIDSH_WAKE_TIME", "wakeHour", func(c *Config, v string) error {
+		hour, minute, err := parseClockTime(v)
+		c.WakeHour, c.WakeMinute = hour, minute
+		return err
+	}},
+	{"KIDSH_MY_NAME", "myName", func(c *Config, v string) error { c.MyName = v; return nil }},
+	{"KIDSH_TODO_FILE", "todoFile", func(c *Config, v string) error { c.TodoFile = v; return nil }},
+	{"WEATHER_URL", "weatherUrl", func(c *Config, v string) error { c.WeatherURL = v; return nil }},
+	{"KIDSH_AUDIT_LOG", "auditLogFile", func(c *Config, v string) error { c.AuditLogFile = v; return nil }},
+	{"KIDSH_STATE_DIR", "stateDir", func(c *Config, v string) error { c.StateDir = v; return nil }},
+}
+
+func (c *Config) applyEnv() error {
+	for _, o := range configEnvOverrides {
+		value := os.Getenv(o.env)
+		if value == "" {
+			continue
+		}
+		if err := o.apply(c, value); err != nil {
+			return &ConfigError{o.key, fmt.Errorf("from $%s: %v", o.env, err)}
+		}
+	}
+	return nil
+}
+
+// parseClockTime parses a 24-hour "HH:MM" time.
+func parseClockTime(s string) (int, int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	hour, err1 := strconv.Atoi(hh)
+	minute, err2 := strconv.Atoi(mm)
+	if !ok || err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("%q is not a time like 21:00", s)
+	}
+	return hour, minute, nil
+}
+
+func validateURL(key, value string) error {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return &ConfigError{key, err}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &ConfigError{key, fmt.Errorf("%q is not an http or https URL", value)}
+	}
+	return nil
+}
+
+// Validate checks every key and reports the first one that is wrong.
+func (c *Config) Validate() error {
+	if err := validateURL("rssUrl", c.RSSURL); err != nil {
+		return err
+	}
+	if err := validateURL("weatherUrl", c.WeatherURL); err != nil {
+		return err
+	}
+	if err := c.validateSchedule(); err != nil {
+		return err
+	}
+	if c.MyName == "" {
+		return &ConfigError{"myName", fmt.Errorf("must not be empty")}
+	}
+	for i, path := range c.AllowedPrograms {
+		if !filepath.IsAbs(path) {
+			return &ConfigError{fmt.Sprintf("allowedPrograms[%d]", i), fmt.Errorf("%q is not an absolute path", path)}
+		}
+	}
+	for i, name := range c.DisabledCommands {
+		if cmd, ok := cmds[name]; !ok || cmd.Name != name {
+			return &ConfigError{fmt.Sprintf("disabledCommands[%d]", i), fmt.Errorf("there is no command named %q", name)}
+		}
+		if name == adminCommand {
+			return &ConfigError{fmt.Sprintf("disabledCommands[%d]", i), fmt.Errorf("admin cannot be turned off")}
+		}
 	}
-}
\ No newline at end of file
+	if c.AuditLogMaxKB <= 0 {
+		return &ConfigError{"auditLogMaxKB", fmt.Errorf("must be at least 1, got %d", c.AuditLogMaxKB)}
+	}
+	if c.AuditLogMaxFiles < 0 {
+		return &ConfigError{"auditLogMaxFiles", fmt.Errorf("must not be negative, got %d", c.AuditLogMaxFiles)}
+	}
+	if c.AdminPinHash != "" {
+		if _, err := parsePinHash(c.AdminPinHash); err != nil {
+			return &ConfigError{"adminPinHash", err}
+		}
+	}
+	if c.AdminTimeoutMinutes <= 0 {
+		return &ConfigError{"adminTimeoutMinutes", fmt.Errorf("must be at least 1, got %d", c.AdminTimeoutMinutes)}
+	}
+	if err := c.Limits.validate(); err != nil {
+		return err
+	}
+	if err := validateBudgets(c); err != nil {
+		return err
+	}
+	if err := validateDrill("drill", c.Drill); err != nil {
+		return err
+	}
+	if c.DrillQuestions <= 0 {
+		return &ConfigError{"drillQuestions", fmt.Errorf("must be at least 1, got %d", c.DrillQuestions)}
+	}
+	return c.validateProfiles()
+}
+
+// configSearchPath returns the places a config file is looked for when no
+// -config flag is given, most specific first.
+func configSearchPath() []string {
+	var paths []string
+	if path := os.Getenv("KIDSH_CONFIG"); path != "" {
+		paths = append(paths, path)
+	}
+	return append(paths, userConfigPath(), filepath.Join("/etc", appName, configFileName))
+}
+
+// loadConfig loads the config file at path, or the first one found on the
+// search path if path is empty, and returns it along with the file it came
+// from. Finding no config file at all is not an error.
+func loadConfig(path string) (*Config, string, error) {
+	c := defaultConfig()
+	if path == "" {
+		for _, candidate := range configSearchPath() {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+	}
+	if path != "" {
+		if err := c.LoadFromFile(path); err != nil {
+			return nil, path, err
+		}
+	}
+	if err := c.applyEnv(); err != nil {
+		return nil, path, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, path, err
+	}
+	return c, path, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestSaveToFile checks that a saved config, which holds the PIN hash, can
+// only be read by its owner and that nothing is left behind.
+func TestSaveToFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"myName": "Old Name"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := defaultConfig()
+	cfg.MyName = "John Doe"
+	cfg.AdminPinHash = hashPin(testPin, []byte("salt"))
+	if err := cfg.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("config is saved with mode %v, want 0600", info.Mode().Perm())
+	}
+	saved := defaultConfig()
+	if err := saved.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if saved.MyName != cfg.MyName || saved.AdminPinHash != cfg.AdminPinHash {
+		t.Errorf("read back %q and %q, want what was saved", saved.MyName, saved.AdminPinHash)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("the config directory has %d files, want just the config", len(entries))
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// CommandContext is everything a builtin gets to work with: where to read
+// input and write output, a context that is cancelled when the command is
+// interrupted, the config, the state of the shell session, and the clock
+// and random numbers to use. In a pipeline like "todo | sort", Stdout of
+// one command is Stdin of the next.
+type CommandContext struct {
+	Ctx     context.Context
+	Config  *Config
+	Session *Session
+	Clock   Clock
+	Rand    *rand.Rand
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// PipedIn is true when Stdin comes from the command before this one in
+	// a pipeline, and PipedOut when Stdout goes to the command after it.
+	PipedIn  bool
+	PipedOut bool
+}
+
+// items returns args, or, if there are none and something is piped in,
+// the items read from Stdin, one per line. A line is never split into
+// words, so that a todo like "wash the dog" stays whole.
+func (c *CommandContext) items(args []string) ([]string, error) {
+	if len(args) > 0 || !c.PipedIn {
+		return args, nil
+	}
+	data, err := io.ReadAll(c.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(stripANSI(string(data)), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// printList prints items on one line separated by sep. When the output is
+// piped into another command, each item goes on its own line instead so
+// that items with spaces in them stay whole.
+func (c *CommandContext) printList(items []string, sep string) {
+	if c.PipedOut {
+		sep = "\n"
+	}
+	fmt.Fprintln(c.Stdout, strings.Join(items, sep))
+}
+
+// sleep waits for d, or returns early with an error if the command is
+// interrupted.
+func (c *CommandContext) sleep(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.Ctx.Done():
+		return c.Ctx.Err()
+	}
+}
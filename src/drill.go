@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// drillFileName is where drill keeps track of which facts a child knows,
+// in their profile's directory.
+const drillFileName = "drill.json"
+
+// DrillRange is the smallest and largest numbers drill uses for one kind
+// of fact. For subtract and divide they are the numbers of the addition or
+// multiplication fact turned around, so 12 - 5 is in the range 0 to 10.
+type DrillRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// defaultDrillQuestions is how many facts drill asks unless the config
+// says otherwise.
+const defaultDrillQuestions = 10
+
+// maxDrillSpan is how many numbers a drill range may cover, which keeps
+// the number of facts to learn reasonable.
+const maxDrillSpan = 100
+
+// The kinds of facts drill asks about, in the order they are shown.
+var drillOps = []string{"add", "subtract", "multiply", "divide"}
+
+var drillOpNames = map[string]string{
+	"add":      "Adding",
+	"subtract": "Taking away",
+	"multiply": "Times tables",
+	"divide":   "Dividing",
+}
+
+// drillOpAliases are the other names a child can use to pick facts.
+var drillOpAliases = map[string]string{
+	"plus": "add", "addition": "add",
+	"sub": "subtract", "minus": "subtract", "subtraction": "subtract",
+	"mult": "multiply", "times": "multiply", "multiplication": "multiply",
+	"div": "divide", "division": "divide",
+}
+
+// defaultDrill is what drill asks about when the config doesn't say.
+var defaultDrill = map[string]*DrillRange{
+	"add":      {Min: 0, Max: 10},
+	"subtract": {Min: 0, Max: 10},
+}
+
+func validateDrill(key string, drill map[string]*DrillRange) error {
+	for op, r := range drill {
+		opKey := key + "." + op
+		if _, ok := drillOpNames[op]; !ok {
+			return &ConfigError{opKey, fmt.Errorf("not a kind of fact; use one of %v", drillOps)}
+		}
+		if r == nil {
+			return &ConfigError{opKey, fmt.Errorf("must not be null")}
+		}
+		if r.Min < 0 || r.Max < r.Min {
+			return &ConfigError{opKey, fmt.Errorf("min must be at least 0 and no more than max, got %d to %d", r.Min, r.Max)}
+		}
+		if r.Max-r.Min >= maxDrillSpan {
+			return &ConfigError{opKey, fmt.Errorf("can cover at most %d numbers, got %d to %d", maxDrillSpan, r.Min, r.Max)}
+		}
+		if op == "divide" && r.Max < 1 {
+			return &ConfigError{opKey + ".max", fmt.Errorf("must be at least 1, since nothing can be divided by 0")}
+		}
+	}
+	return nil
+}
+
+// drillRanges returns the facts the child using the shell should drill.
+func (c *CommandContext) drillRanges() map[string]*DrillRange {
+	if p := c.Config.Profiles[c.Session.Profile]; p != nil && len(p.Drill) > 0 {
+		return p.Drill
+	}
+	if len(c.Config.Drill) > 0 {
+		return c.Config.Drill
+	}
+	return defaultDrill
+}
+
+// mathFact is one flash card, like 7 × 8 = 56.
+type mathFact struct {
+	op       string
+	question string
+	answer   int
+}
+
+// mathFacts returns every fact of kind op in r.
+func mathFacts(op string, r *DrillRange) []mathFact {
+	var facts []mathFact
+	for a := r.Min; a <= r.Max; a++ {
+		for b := r.Min; b <= r.Max; b++ {
+			switch op {
+			case "add":
+				facts = append(facts, mathFact{op, fmt.Sprintf("%d + %d", a, b), a + b})
+			case "subtract":
+				facts = append(facts, mathFact{op, fmt.Sprintf("%d - %d", a+b, b), a})
+			case "multiply":
+				facts = append(facts, mathFact{op, fmt.Sprintf("%d × %d", a, b), a * b})
+			case "divide":
+				if b > 0 {
+					facts = append(facts, mathFact{op, fmt.Sprintf("%d ÷ %d", a*b, b), a})
+				}
+			}
+		}
+	}
+	return facts
+}
+
+// Facts move through leitnerBoxes boxes, like flash cards in a row of
+// boxes. A fact answered right moves up a box and is asked again after
+// the wait for that box; one answered wrong goes back to box 1, which is
+// asked every time.
+const leitnerBoxes = 5
+
+var boxWaits = [leitnerBoxes]time.Duration{0, 24 * time.Hour, 3 * 24 * time.Hour, 7 * 24 * time.Hour, 14 * 24 * time.Hour}
+
+// FactRecord is how a child has done on one fact.
+type FactRecord struct {
+	Box   int       `json:"box"`
+	Due   time.Time `json:"due"`
+	Right int       `json:"right"`
+	Wrong int       `json:"wrong"`
+
+	// Time is the time spent on all the answers.
+	Time time.Duration `json:"time"`
+}
+
+func (s *Session) drillPath() string {
+	return filepath.Join(s.Dir, drillFileName)
+}
+
+// readDrill returns the records of the facts a child has been asked, by
+// question.
+func readDrill(c *CommandContext) (map[string]*FactRecord, error) {
+	records := map[string]*FactRecord{}
+	data, err := os.ReadFile(c.Session.drillPath())
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("%s: %v", drillFileName, err)
+	}
+	// The file may have been edited by hand, so keep every fact in a box.
+	for q, rec := range records {
+		switch {
+		case rec == nil:
+			delete(records, q)
+		case rec.Box < 1:
+			rec.Box = 1
+		case rec.Box > leitnerBoxes:
+			rec.Box = leitnerBoxes
+		}
+	}
+	return records, nil
+}
+
+func writeDrill(c *CommandContext, records map[string]*FactRecord) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.Session.drillPath(), data, 0600)
+}
+
+// chooseFacts picks n facts to ask: the ones that are due, lowest box
+// first and the most missed first within a box, then ones that are due
+// soonest.
+func chooseFacts(c *CommandContext, facts []mathFact, records map[string]*FactRecord, n int) []mathFact {
+	now := c.Clock.Now()
+	c.Rand.Shuffle(len(facts), func(i, j int) { facts[i], facts[j] = facts[j], facts[i] })
+	record := func(f mathFact) FactRecord {
+		if r := records[f.question]; r != nil {
+			return *r
+		}
+		return FactRecord{Box: 1}
+	}
+	sort.SliceStable(facts, func(i, j int) bool {
+		a, b := record(facts[i]), record(facts[j])
+		aDue, bDue := !a.Due.After(now), !b.Due.After(now)
+		switch {
+		case aDue != bDue:
+			return aDue
+		case !aDue:
+			return a.Due.Before(b.Due)
+		case a.Box != b.Box:
+			return a.Box < b.Box
+		}
+		return a.Wrong > b.Wrong
+	})
+	if len(facts) > n {
+		facts = facts[:n]
+	}
+	c.Rand.Shuffle(len(facts), func(i, j int) { facts[i], facts[j] = facts[j], facts[i] })
+	return facts
+}
+
+// drillAnswer is how a child answered one fact in a drill.
+type drillAnswer struct {
+	fact  mathFact
+	right bool
+	time  time.Duration
+}
+
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.1f seconds", d.Seconds())
+}
+
+// showDrillResults prints how a drill went.
+func showDrillResults(c *CommandContext, answers []drillAnswer) {
+	if len(answers) == 0 {
+		return
+	}
+	right := 0
+	var total time.Duration
+	fastest, slowest := answers[0], answers[0]
+	var missed []string
+	for _, a := range answers {
+		total += a.time
+		if a.right {
+			right++
+			if a.time < fastest.time || !fastest.right {
+				fastest = a
+			}
+		} else {
+			missed = append(missed, fmt.Sprintf("%s = %d", a.fact.question, a.fact.answer))
+		}
+		if a.time > slowest.time {
+			slowest = a
+		}
+	}
+	fmt.Fprintln(c.Stdout)
+	if right == len(answers) {
+		fmt.Fprintf(c.Stdout, "%sYou got all %d right!%s\n", BoldText, right, NormalText)
+	} else {
+		fmt.Fprintf(c.Stdout, "%sYou got %d out of %d right.%s\n", BoldText, right, len(answers), NormalText)
+	}
+	fmt.Fprintf(c.Stdout, "Average time: %s.\n", formatSeconds(total/time.Duration(len(answers))))
+	if right > 0 {
+		fmt.Fprintf(c.Stdout, "Fastest: %s in %s.\n", fastest.fact.question, formatSeconds(fastest.time))
+	}
+	fmt.Fprintf(c.Stdout, "Slowest: %s in %s.\n", slowest.fact.question, formatSeconds(slowest.time))
+	if len(missed) > 0 {
+		fmt.Fprintf(c.Stdout, "Practice these: %s\n", strings.Join(missed, ", "))
+	}
+}
+
+// showDrillStats prints how many facts of each kind are in each box, and
+// the facts missed most.
+func showDrillStats(c *CommandContext, ranges map[string]*DrillRange, records map[string]*FactRecord) {
+	fmt.Fprintf(c.Stdout, "%-14s %5s", "", "New")
+	for box := 1; box <= leitnerBoxes; box++ {
+		fmt.Fprintf(c.Stdout, "  Box %d", box)
+	}
+	fmt.Fprintln(c.Stdout)
+	var hardest []string
+	for _, op := range drillOps {
+		r := ranges[op]
+		if r == nil {
+			continue
+		}
+		var counts [leitnerBoxes + 1]int
+		for _, f := range mathFacts(op, r) {
+			rec := records[f.question]
+			if rec == nil {
+				counts[0]++
+				continue
+			}
+			counts[rec.Box]++
+			if rec.Wrong > 0 {
+				hardest = append(hardest, f.question)
+			}
+		}
+		fmt.Fprintf(c.Stdout, "%-14s %5d", drillOpNames[op], counts[0])
+		for box := 1; box <= leitnerBoxes; box++ {
+			fmt.Fprintf(c.Stdout, "  %5d", counts[box])
+		}
+		fmt.Fprintln(c.Stdout)
+	}
+	if len(hardest) == 0 {
+		return
+	}
+	sort.SliceStable(hardest, func(i, j int) bool {
+		return records[hardest[i]].Wrong > records[hardest[j]].Wrong
+	})
+	if len(hardest) > 5 {
+		hardest = hardest[:5]
+	}
+	for i, q := range hardest {
+		hardest[i] = fmt.Sprintf("%s (missed %d)", q, records[q].Wrong)
+	}
+	fmt.Fprintf(c.Stdout, "Hardest facts: %s\n", strings.Join(hardest, ", "))
+}
+
+func doDrill(c *CommandContext, args []string) error {
+	ranges := c.drillRanges()
+	records, err := readDrill(c)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 && args[0] == "stats" {
+		showDrillStats(c, ranges, records)
+		return nil
+	}
+
+	var facts []mathFact
+	for _, op := range drillOps {
+		if ranges[op] != nil && (len(args) == 0 || args[0] == op || drillOpAliases[args[0]] == op) {
+			facts = append(facts, mathFacts(op, ranges[op])...)
+		}
+	}
+	if len(facts) == 0 {
+		var ops []string
+		for _, op := range drillOps {
+			if ranges[op] != nil {
+				ops = append(ops, op)
+			}
+		}
+		return fmt.Errorf("drill can do %s, not %q", strings.Join(ops, ", "), args[0])
+	}
+
+	fmt.Fprintf(c.Stdout, "Type the answer and press Enter, or type %sdone%s to stop.\n", BoldText, NormalText)
+	facts = chooseFacts(c, facts, records, c.Config.DrillQuestions)
+	var answers []drillAnswer
+	var readErr error
+questions:
+	for i, f := range facts {
+		start := c.Clock.Now()
+		var n int
+		skipped := false
+		for {
+			line, err := readAnswer(c, fmt.Sprintf("%d/%d  %s = ", i+1, len(facts), f.question))
+			if err == io.EOF || err == errInterrupted {
+				fmt.Fprintln(c.Stdout)
+				break questions
+			}
+			if err != nil {
+				readErr = err
+				break questions
+			}
+			line = strings.TrimSpace(line)
+			switch line {
+			case "done", "quit", "exit":
+				break questions
+			}
+			// Pressing Enter without an answer skips the fact, which
+			// counts as missing it.
+			if line == "" {
+				skipped = true
+				break
+			}
+			if n, err = strconv.Atoi(line); err == nil {
+				break
+			}
+			fmt.Fprintf(c.Stdout, "Type the answer as a number, or %sdone%s to stop.\n", BoldText, NormalText)
+		}
+		a := drillAnswer{f, !skipped && n == f.answer, c.Clock.Now().Sub(start)}
+		answers = append(answers, a)
+
+		rec := records[f.question]
+		if rec == nil {
+			rec = &FactRecord{Box: 1}
+			records[f.question] = rec
+		}
+		rec.Time += a.time
+		if a.right {
+			rec.Right++
+			if rec.Box < leitnerBoxes {
+				rec.Box++
+			}
+			fmt.Fprintf(c.Stdout, "%sRight!%s\n", GreenText, NormalText)
+		} else {
+			rec.Wrong++
+			rec.Box = 1
+			fmt.Fprintf(c.Stdout, "%sNot quite. %s = %d.%s\n", YellowText, f.question, f.answer, NormalText)
+		}
+		rec.Due = c.Clock.Now().Add(boxWaits[rec.Box-1])
+	}
+	if len(answers) > 0 {
+		if err := writeDrill(c, records); err != nil {
+			return err
+		}
+	}
+	showDrillResults(c, answers)
+	return readErr
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// autosaveInterval is how often edit saves while the child is typing.
+const autosaveInterval = 5 * time.Second
+
+// editorPoll is how long edit waits for a key before checking whether it
+// is time to autosave.
+const editorPoll = 100 * time.Millisecond
+
+// editor is a small full-screen text editor. The text is a list of
+// paragraphs, each word-wrapped over as many lines of the screen as it
+// needs. In big-letter mode every line is drawn twice as wide and twice
+// as tall.
+type editor struct {
+	out  io.Writer
+	now  func() time.Time
+	name string // What the child calls the file.
+	path string // Where it really is.
+
+	paras    [][]rune
+	row, col int // The cursor, as a paragraph and a rune in it.
+	top      int // The first line on the screen.
+
+	cols, rows int
+	big        bool
+
+	dirty    bool
+	saved    bool
+	lastSave time.Time
+	status   string
+}
+
+// visualLine is one line on the screen: the runes start to end of a
+// paragraph.
+type visualLine struct {
+	para, start, end int
+}
+
+// wrapParagraph returns where each line starts when p is wrapped to width.
+// Lines break after the last space that fits, or in the middle of a word
+// that is longer than a whole line.
+func wrapParagraph(p []rune, width int) []int {
+	starts := []int{0}
+	start := 0
+	for len(p)-start > width {
+		end := start + width
+		for i := start + width; i > start; i-- {
+			if p[i] == ' ' {
+				end = i + 1
+				break
+			}
+		}
+		starts = append(starts, end)
+		start = end
+	}
+	return starts
+}
+
+func (e *editor) width() int {
+	if e.big {
+		return e.cols/2 - 1
+	}
+	return e.cols - 1
+}
+
+// height is how many lines of text fit between the title and the help.
+func (e *editor) height() int {
+	if e.big {
+		return (e.rows - 2) / 2
+	}
+	return e.rows - 2
+}
+
+func (e *editor) lines() []visualLine {
+	var lines []visualLine
+	for i, p := range e.paras {
+		starts := wrapParagraph(p, e.width())
+		for j, start := range starts {
+			end := len(p)
+			if j+1 < len(starts) {
+				end = starts[j+1]
+			}
+			lines = append(lines, visualLine{i, start, end})
+		}
+	}
+	return lines
+}
+
+// lastInPara returns whether lines[i] is the last line of its paragraph.
+func lastInPara(lines []visualLine, i int) bool {
+	return i+1 == len(lines) || lines[i+1].para != lines[i].para
+}
+
+// cursorLine returns which of lines the cursor is on.
+func (e *editor) cursorLine(lines []visualLine) int {
+	for i, l := range lines {
+		if l.para == e.row && e.col >= l.start && (e.col < l.end || lastInPara(lines, i)) {
+			return i
+		}
+	}
+	return 0
+}
+
+func (e *editor) load() error {
+	data, err := os.ReadFile(e.path)
+	if os.IsNotExist(err) {
+		e.paras = [][]rune{{}}
+		e.status = "New file"
+		return nil
+	}
+	if err != nil {
+		return pathError(err, e.name)
+	}
+	if !isTextFile(data) {
+		return fmt.Errorf("%s isn't something you can write in", e.name)
+	}
+	text := strings.ReplaceAll(string(data), "\r", "")
+	text = strings.ReplaceAll(text, "\t", "    ")
+	for _, p := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		e.paras = append(e.paras, []rune(p))
+	}
+	return nil
+}
+
+func (e *editor) save() error {
+	var text []string
+	for _, p := range e.paras {
+		text = append(text, string(p))
+	}
+	data := strings.Join(text, "\n")
+	if data != "" {
+		data += "\n"
+	}
+	if err := os.WriteFile(e.path, []byte(data), 0644); err != nil {
+		e.status = "Couldn't save!"
+		return pathError(err, e.name)
+	}
+	e.dirty = false
+	e.saved = true
+	e.lastSave = e.now()
+	e.status = "Saved at " + e.lastSave.Format("3:04 PM")
+	return nil
+}
+
+// finish saves any changes that haven't been saved yet.
+func (e *editor) finish() error {
+	if !e.dirty {
+		return nil
+	}
+	return e.save()
+}
+
+func (e *editor) insert(r rune) {
+	p := e.paras[e.row]
+	p = append(p, 0)
+	copy(p[e.col+1:], p[e.col:])
+	p[e.col] = r
+	e.paras[e.row] = p
+	e.col++
+	e.dirty = true
+}
+
+// newParagraph splits the paragraph at the cursor.
+func (e *editor) newParagraph() {
+	p := e.paras[e.row]
+	rest := append([]rune{}, p[e.col:]...)
+	e.paras[e.row] = p[:e.col]
+	e.paras = append(e.paras, nil)
+	copy(e.paras[e.row+2:], e.paras[e.row+1:])
+	e.paras[e.row+1] = rest
+	e.row++
+	e.col = 0
+	e.dirty = true
+}
+
+// joinNext joins the paragraph after the cursor's onto it.
+func (e *editor) joinNext() {
+	e.paras[e.row] = append(e.paras[e.row], e.paras[e.row+1]...)
+	e.paras = append(e.paras[:e.row+1], e.paras[e.row+2:]...)
+	e.dirty = true
+}
+
+func (e *editor) backspace() {
+	switch {
+	case e.col > 0:
+		p := e.paras[e.row]
+		e.paras[e.row] = append(p[:e.col-1], p[e.col:]...)
+		e.col--
+		e.dirty = true
+	case e.row > 0:
+		e.row--
+		e.col = len(e.paras[e.row])
+		e.joinNext()
+	}
+}
+
+func (e *editor) delete() {
+	p := e.paras[e.row]
+	switch {
+	case e.col < len(p):
+		e.paras[e.row] = append(p[:e.col], p[e.col+1:]...)
+		e.dirty = true
+	case e.row+1 < len(e.paras):
+		e.joinNext()
+	}
+}
+
+func (e *editor) left() {
+	switch {
+	case e.col > 0:
+		e.col--
+	case e.row > 0:
+		e.row--
+		e.col = len(e.paras[e.row])
+	}
+}
+
+func (e *editor) right() {
+	switch {
+	case e.col < len(e.paras[e.row]):
+		e.col++
+	case e.row+1 < len(e.paras):
+		e.row++
+		e.col = 0
+	}
+}
+
+// moveLines moves the cursor up or down by n lines on the screen, keeping
+// it as close as it can to the same column.
+func (e *editor) moveLines(n int) {
+	lines := e.lines()
+	cur := e.cursorLine(lines)
+	target := cur + n
+	if target < 0 {
+		target = 0
+	}
+	if target >= len(lines) {
+		target = len(lines) - 1
+	}
+	l := lines[target]
+	e.row = l.para
+	e.col = l.start + e.col - lines[cur].start
+	e.clampToLine(lines, target)
+}
+
+// clampToLine keeps the cursor on lines[i] rather than the start of the
+// line after it.
+func (e *editor) clampToLine(lines []visualLine, i int) {
+	end := lines[i].end
+	if !lastInPara(lines, i) {
+		end--
+	}
+	if e.col > end {
+		e.col = end
+	}
+}
+
+func (e *editor) home() {
+	lines := e.lines()
+	e.col = lines[e.cursorLine(lines)].start
+}
+
+func (e *editor) end() {
+	lines := e.lines()
+	i := e.cursorLine(lines)
+	e.col = lines[i].end
+	e.clampToLine(lines, i)
+}
+
+// handle acts on one key, returning true when the child is done.
+func (e *editor) handle(key string) (bool, error) {
+	switch key {
+	case string(rune(keyEscape)), string(rune(keyCtrlQ)), string(rune(keyCtrlC)):
+		return true, nil
+	case string(rune(keyCtrlS)):
+		return false, e.save()
+	case string(rune(keyCtrlB)):
+		e.big = !e.big
+		e.top = 0
+	case string(rune(keyReturn)), string(rune(keyLineFeed)):
+		e.newParagraph()
+	case string(rune(keyDelete)), string(rune(keyBackspace)):
+		e.backspace()
+	case string(rune(keyTab)):
+		for i := 0; i < 4; i++ {
+			e.insert(' ')
+		}
+	case "\033[A", "\033OA":
+		e.moveLines(-1)
+	case "\033[B", "\033OB":
+		e.moveLines(1)
+	case "\033[C", "\033OC":
+		e.right()
+	case "\033[D", "\033OD":
+		e.left()
+	case "\033[H", "\033OH", "\033[1~", "\033[7~":
+		e.home()
+	case "\033[F", "\033OF", "\033[4~", "\033[8~":
+		e.end()
+	case "\033[5~": // Page Up
+		e.moveLines(-e.height())
+	case "\033[6~": // Page Down
+		e.moveLines(e.height())
+	case "\033[3~":
+		e.delete()
+	default:
+		if r, size := utf8.DecodeRuneInString(key); size == len(key) && r != utf8.RuneError && unicode.IsPrint(r) {
+			e.insert(r)
+		}
+	}
+	return false, nil
+}
+
+// nextKey returns the first key in buf and how many bytes it took. It
+// returns a size of 0 if the key isn't all there yet, unless waited is set,
+// meaning no more is coming and a lone ESC is the Esc key.
+func nextKey(buf []byte, waited bool) (string, int) {
+	if buf[0] != keyEscape {
+		if !utf8.FullRune(buf) && !waited {
+			return "", 0
+		}
+		_, size := utf8.DecodeRune(buf)
+		return string(buf[:size]), size
+	}
+	if len(buf) == 1 {
+		if waited {
+			return string(buf[:1]), 1
+		}
+		return "", 0
+	}
+	if buf[1] != '[' && buf[1] != 'O' {
+		return string(buf[:1]), 1
+	}
+	for i := 2; i < len(buf); i++ {
+		if buf[i] >= 0x40 && buf[i] <= 0x7E {
+			return string(buf[:i+1]), i + 1
+		}
+	}
+	if waited {
+		// Part of a key we don't know; throw it away.
+		return "", len(buf)
+	}
+	return "", 0
+}
+
+// fitWidth cuts s to width runes, or pads it with spaces to width.
+func fitWidth(s string, width int) string {
+	r := []rune(s)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return s + strings.Repeat(" ", width-len(r))
+}
+
+func (e *editor) draw() {
+	var b bytes.Buffer
+	lines := e.lines()
+	cur := e.cursorLine(lines)
+	height := e.height()
+	if cur < e.top {
+		e.top = cur
+	}
+	if cur >= e.top+height {
+		e.top = cur - height + 1
+	}
+
+	title := " " + e.name
+	if e.dirty {
+		title += " *"
+	}
+	if e.status != "" {
+		title += "   " + e.status
+	}
+	b.WriteString("\033[H\033#5")
+	b.WriteString(highlightBlue(fitWidth(title, e.cols)))
+	b.WriteString("\r\n")
+	for i := 0; i < height; i++ {
+		text := ""
+		if n := e.top + i; n < len(lines) {
+			l := lines[n]
+			line := e.paras[l.para][l.start:l.end]
+			if len(line) > e.width() {
+				line = line[:e.width()] // A space hanging off the end.
+			}
+			text = string(line)
+		}
+		if e.big {
+			fmt.Fprintf(&b, "\033#3%s\033[K\r\n\033#4%s\033[K\r\n", text, text)
+		} else {
+			fmt.Fprintf(&b, "\033#5%s\033[K\r\n", text)
+		}
+	}
+	b.WriteString("\033[J")
+	fmt.Fprintf(&b, "\033[%d;1H\033#5%sEsc%s done  %sCtrl-S%s save  %sCtrl-B%s big letters", e.rows, BoldText, NormalText, BoldText, NormalText, BoldText, NormalText)
+
+	y := 2 + cur - e.top
+	if e.big {
+		y = 2 + 2*(cur-e.top)
+	}
+	x := 1 + e.col - lines[cur].start
+	fmt.Fprintf(&b, "\033[%d;%dH", y, x)
+	e.out.Write(b.Bytes())
+}
+
+// run reads keys from in until the child is done, redrawing the screen
+// after each and saving every autosaveInterval while there are changes.
+// Reads from in must time out now and then with io.EOF.
+func (e *editor) run(ctx context.Context, in io.Reader, size func() (int, int, error)) error {
+	var buf []byte
+	chunk := make([]byte, 64)
+	e.draw()
+	for {
+		if ctx.Err() != nil {
+			return e.finish()
+		}
+		if cols, rows, err := size(); err == nil && (cols != e.cols || rows != e.rows) {
+			e.cols, e.rows = cols, rows
+			e.draw()
+		}
+		n, err := in.Read(chunk)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		buf = append(buf, chunk[:n]...)
+		redraw := false
+		for len(buf) > 0 {
+			key, size := nextKey(buf, n == 0)
+			if size == 0 {
+				break
+			}
+			buf = buf[size:]
+			done, err := e.handle(key)
+			if done {
+				return e.finish()
+			}
+			if err != nil {
+				return err
+			}
+			redraw = true
+		}
+		if e.dirty && e.now().Sub(e.lastSave) >= autosaveInterval {
+			if err := e.save(); err != nil {
+				return err
+			}
+			redraw = true
+		}
+		if redraw {
+			e.draw()
+		}
+	}
+}
+
+func doEdit(c *CommandContext, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("what do you want to write? Type edit and a name, like: edit story.txt")
+	}
+	fd, ok := terminalFd(c.Stdin)
+	if !ok || c.PipedOut {
+		return fmt.Errorf("edit needs a screen and a keyboard")
+	}
+	cols, rows, err := terminalSize(fd)
+	if err != nil {
+		return err
+	}
+	if cols < 20 || rows < 6 {
+		return fmt.Errorf("the screen is too small to write on")
+	}
+	virtual, host, err := c.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	if isDir(host) {
+		return fmt.Errorf("%s is a folder", virtual)
+	}
+	if !isDir(filepath.Dir(host)) {
+		return fmt.Errorf("there is no folder %s", filepath.ToSlash(filepath.Dir(virtual)))
+	}
+	e := &editor{
+		out:      c.Stdout,
+		now:      c.Clock.Now,
+		name:     virtual,
+		path:     host,
+		cols:     cols,
+		rows:     rows,
+		lastSave: c.Clock.Now(),
+	}
+	if err := e.load(); err != nil {
+		return err
+	}
+
+	state, err := makeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer restoreTerminal(fd, state)
+	if err := setReadTimeout(fd, editorPoll); err != nil {
+		return err
+	}
+	fmt.Fprint(c.Stdout, "\033[?1049h") // Use the alternate screen.
+	err = e.run(c.Ctx, c.Stdin, func() (int, int, error) { return terminalSize(fd) })
+	fmt.Fprint(c.Stdout, "\033[?1049l")
+	if err != nil {
+		return err
+	}
+	if e.saved {
+		fmt.Fprintf(c.Stdout, "Saved %s.\n", virtual)
+	}
+	return nil
+}
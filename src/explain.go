@@ -0,0 +1,416 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// sumColumn is how wide each column of a written sum is. Three characters
+// leave room for a borrowed 13 over a digit, with a space before it.
+const sumColumn = 3
+
+// placeNames name the columns of a number, from the right.
+var placeNames = []string{
+	"ones", "tens", "hundreds",
+	"thousands", "ten thousands", "hundred thousands",
+	"millions", "ten millions", "hundred millions",
+	"billions", "ten billions", "hundred billions",
+	"trillions", "ten trillions", "hundred trillions",
+}
+
+// placeName returns the name of the kth column from the right, counting
+// from 0 for the ones.
+func placeName(k int) string {
+	if k < len(placeNames) {
+		return placeNames[k]
+	}
+	return fmt.Sprintf("column %d", k+1)
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// wantsSteps returns whether args start with show or explain, and the rest
+// of args.
+func wantsSteps(args []string) (bool, []string) {
+	if len(args) > 0 && (args[0] == "show" || args[0] == "explain") {
+		return true, args[1:]
+	}
+	return false, args
+}
+
+// wholeNumbers parses args as whole numbers, 0 and up, which is what sums
+// written in columns work with.
+func wholeNumbers(args []string) ([]*big.Int, error) {
+	var nums []*big.Int
+	for _, arg := range args {
+		n, ok := new(big.Int).SetString(arg, 10)
+		if !ok || n.Sign() < 0 {
+			return nil, fmt.Errorf("%q isn't a whole number; show works with numbers like 0, 7 and 42", arg)
+		}
+		nums = append(nums, n)
+	}
+	return nums, nil
+}
+
+// sumGrid lays out a sum the way it is written on paper, one digit to a
+// column, with a margin on the left for the + or the divisor.
+type sumGrid struct {
+	margin int
+	cols   int
+	lines  []string
+}
+
+// row adds a line with label at the right of the margin and cells in the
+// columns. An empty cell leaves its column blank, and a row of empty cells
+// with no label isn't added.
+func (g *sumGrid) row(label string, cells []string) {
+	if label == "" && strings.Join(cells, "") == "" {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%*s", g.margin, label)
+	for _, cell := range cells {
+		b.WriteString(strings.Repeat(" ", sumColumn-len(stripANSI(cell))))
+		b.WriteString(cell)
+	}
+	g.lines = append(g.lines, strings.TrimRight(b.String(), " "))
+}
+
+// rule draws a line under the columns from first to last.
+func (g *sumGrid) rule(first, last int) {
+	g.lines = append(g.lines, strings.Repeat(" ", g.margin+sumColumn*first)+strings.Repeat("-", sumColumn*(last-first+1)))
+}
+
+// place returns cells with the digits of s ending in column last, each
+// passed through color if it isn't nil.
+func (g *sumGrid) place(s string, last int, color func(string) string) []string {
+	cells := make([]string, g.cols)
+	for i, r := range s {
+		col := last - len(s) + 1 + i
+		if col < 0 || col >= g.cols {
+			continue
+		}
+		cells[col] = string(r)
+		if color != nil {
+			cells[col] = color(cells[col])
+		}
+	}
+	return cells
+}
+
+func (g *sumGrid) print(c *CommandContext) {
+	for _, line := range g.lines {
+		fmt.Fprintln(c.Stdout, line)
+	}
+	fmt.Fprintln(c.Stdout)
+}
+
+// digitAt returns the kth digit of n from the right, and whether n has one.
+func digitAt(n string, k int) (int, bool) {
+	if k >= len(n) {
+		return 0, false
+	}
+	return int(n[len(n)-1-k] - '0'), true
+}
+
+// showAddition adds nums in columns, carrying into the next column.
+func showAddition(c *CommandContext, nums []*big.Int) error {
+	if len(nums) < 2 {
+		return fmt.Errorf("show needs at least two numbers to add")
+	}
+	total := new(big.Int)
+	var digits []string
+	for _, n := range nums {
+		total.Add(total, n)
+		digits = append(digits, n.String())
+	}
+	answer := total.String()
+	g := &sumGrid{margin: 2, cols: len(answer)}
+
+	carries := make([]string, g.cols)
+	var steps []string
+	carry := 0
+	for k := 0; k < g.cols; k++ {
+		var terms []string
+		sum := carry
+		if carry > 0 {
+			terms = append(terms, highlightYellow(fmt.Sprint(carry)))
+		}
+		for _, n := range digits {
+			if d, ok := digitAt(n, k); ok {
+				sum += d
+				terms = append(terms, fmt.Sprint(d))
+			}
+		}
+		if len(terms) == 0 {
+			break
+		}
+		step := fmt.Sprintf("%s: %s = %d.", capitalize(placeName(k)), strings.Join(terms, " + "), sum)
+		carry = sum / 10
+		if carry > 0 && k < g.cols-1 && k+1 < maxLen(digits) {
+			step += fmt.Sprintf(" Write %d and carry %d to the %s.", sum%10, carry, placeName(k+1))
+			carries[g.cols-2-k] = highlightYellow(fmt.Sprint(carry))
+		} else {
+			step += fmt.Sprintf(" Write %d.", sum)
+			carry = 0
+		}
+		steps = append(steps, step)
+		if sum >= 10 && k+1 >= maxLen(digits) {
+			break
+		}
+	}
+
+	g.row("", carries)
+	for i, n := range digits {
+		label := ""
+		if i == len(digits)-1 {
+			label = "+"
+		}
+		g.row(label, g.place(n, g.cols-1, nil))
+	}
+	g.rule(0, g.cols-1)
+	g.row("", g.place(answer, g.cols-1, highlightGreen))
+	g.print(c)
+	for _, step := range steps {
+		fmt.Fprintln(c.Stdout, step)
+	}
+	fmt.Fprintf(c.Stdout, "So %s = %s.\n", strings.Join(digits, " + "), answer)
+	return nil
+}
+
+func maxLen(strs []string) int {
+	n := 0
+	for _, s := range strs {
+		if len(s) > n {
+			n = len(s)
+		}
+	}
+	return n
+}
+
+// showSubtraction takes one number away from another in columns,
+// borrowing from the next column when a digit is too small.
+func showSubtraction(c *CommandContext, nums []*big.Int) error {
+	if len(nums) != 2 {
+		return fmt.Errorf("show needs two numbers: the one to start with and the one to take away")
+	}
+	if nums[0].Cmp(nums[1]) < 0 {
+		return fmt.Errorf("to show the steps, put the bigger number first")
+	}
+	a, b := nums[0].String(), nums[1].String()
+	answer := new(big.Int).Sub(nums[0], nums[1]).String()
+	g := &sumGrid{margin: 2, cols: len(a)}
+
+	top := make([]int, g.cols)
+	for i := range a {
+		top[i] = int(a[i] - '0')
+	}
+	changed := make([]bool, g.cols)
+	var steps []string
+	for k := 0; k < g.cols; k++ {
+		i := g.cols - 1 - k
+		d, ok := digitAt(b, k)
+		if !ok {
+			if k >= len(answer) {
+				break
+			}
+			steps = append(steps, fmt.Sprintf("%s: there's nothing to take away, so write %d.", capitalize(placeName(k)), top[i]))
+			continue
+		}
+		step := fmt.Sprintf("%s: ", capitalize(placeName(k)))
+		if top[i] < d {
+			j := i - 1
+			for top[j] == 0 {
+				j--
+			}
+			top[j]--
+			changed[j] = true
+			for m := j + 1; m < i; m++ {
+				top[m] = 9
+				changed[m] = true
+			}
+			top[i] += 10
+			changed[i] = true
+			step += fmt.Sprintf("%d is less than %d, so borrow 1 from the %s. ", top[i]-10, d, placeName(g.cols-1-j))
+			if j < i-1 {
+				step += "The zeros on the way each become 9. "
+			}
+		}
+		digit := fmt.Sprint(top[i])
+		if changed[i] {
+			digit = highlightRed(digit)
+		}
+		step += fmt.Sprintf("%s - %d = %d.", digit, d, top[i]-d)
+		steps = append(steps, step)
+	}
+
+	borrowed := make([]string, g.cols)
+	for i, ok := range changed {
+		if ok {
+			borrowed[i] = highlightRed(fmt.Sprint(top[i]))
+		}
+	}
+	g.row("", borrowed)
+	g.row("", g.place(a, g.cols-1, nil))
+	g.row("-", g.place(b, g.cols-1, nil))
+	g.rule(0, g.cols-1)
+	g.row("", g.place(answer, g.cols-1, highlightGreen))
+	g.print(c)
+	for _, step := range steps {
+		fmt.Fprintln(c.Stdout, step)
+	}
+	fmt.Fprintf(c.Stdout, "So %s - %s = %s.\n", a, b, answer)
+	return nil
+}
+
+// showMultiplication prints the times table of one number, or multiplies
+// two numbers the long way, one digit of the second number at a time.
+func showMultiplication(c *CommandContext, nums []*big.Int) error {
+	switch len(nums) {
+	case 1:
+		return showTimesTable(c, nums[0])
+	case 2:
+	default:
+		return fmt.Errorf("show needs one number for its times table, or two numbers to multiply")
+	}
+	a, b := nums[0].String(), nums[1].String()
+	product := new(big.Int).Mul(nums[0], nums[1])
+	answer := product.String()
+	cols := len(answer)
+	if len(a) > cols {
+		cols = len(a)
+	}
+	if len(b) > cols {
+		cols = len(b)
+	}
+	g := &sumGrid{margin: 2, cols: cols}
+	g.row("", g.place(a, cols-1, nil))
+	g.row("×", g.place(b, cols-1, nil))
+	g.rule(0, cols-1)
+
+	var steps, partials []string
+	if len(b) > 1 {
+		for k := 0; k < len(b); k++ {
+			d, _ := digitAt(b, k)
+			partial := new(big.Int).Mul(nums[0], big.NewInt(int64(d)))
+			digits := partial.String()
+			if partial.Sign() > 0 {
+				digits += strings.Repeat("0", k)
+			}
+			partials = append(partials, digits)
+			label := ""
+			if k == len(b)-1 {
+				label = "+"
+			}
+			// The zeros that hold the places are yellow.
+			cells := g.place(digits, cols-1, nil)
+			for z := 0; z < k && partial.Sign() > 0; z++ {
+				cells[cols-1-z] = highlightYellow("0")
+			}
+			g.row(label, cells)
+			if k == 0 {
+				steps = append(steps, fmt.Sprintf("%s × %d = %s.", a, d, digits))
+			} else {
+				steps = append(steps, fmt.Sprintf("%s × %d %s = %s.", a, d, placeName(k), digits))
+			}
+		}
+		g.rule(0, cols-1)
+		steps = append(steps, fmt.Sprintf("Add them up: %s = %s.", strings.Join(partials, " + "), answer))
+	}
+	g.row("", g.place(answer, cols-1, highlightGreen))
+	g.print(c)
+	for _, step := range steps {
+		fmt.Fprintln(c.Stdout, step)
+	}
+	fmt.Fprintf(c.Stdout, "So %s × %s = %s.\n", a, b, answer)
+	return nil
+}
+
+func showTimesTable(c *CommandContext, n *big.Int) error {
+	width := len(new(big.Int).Mul(n, big.NewInt(12)).String())
+	for i := int64(1); i <= 12; i++ {
+		product := new(big.Int).Mul(n, big.NewInt(i)).String()
+		fmt.Fprintf(c.Stdout, "%s × %2d = %*s%s\n", n, i, width-len(product), "", highlightGreen(product))
+	}
+	return nil
+}
+
+// divisionStep is one turn of long division: how many times the divisor
+// goes into part, and the product to take away, ending at column end.
+type divisionStep struct {
+	end            int
+	part, product  *big.Int
+	quotientDigit  int64
+	remainderAfter *big.Int
+}
+
+// showDivision divides the long way: one digit of the answer at a time,
+// taking away and bringing down the next digit.
+func showDivision(c *CommandContext, nums []*big.Int) error {
+	if len(nums) != 2 {
+		return fmt.Errorf("show needs two numbers: the one to share out and how many to share it between")
+	}
+	dividend, divisor := nums[0], nums[1]
+	if divisor.Sign() == 0 {
+		return errDivideByZero
+	}
+	digits := dividend.String()
+	quotient, remainder := new(big.Int).QuoRem(dividend, divisor, new(big.Int))
+	answer := quotient.String()
+	if remainder.Sign() > 0 {
+		answer += " remainder " + remainder.String()
+	}
+	if quotient.Sign() == 0 {
+		fmt.Fprintf(c.Stdout, "%s is smaller than %s, so %s goes in 0 times.\n", digits, divisor, divisor)
+		fmt.Fprintf(c.Stdout, "So %s ÷ %s = %s.\n", digits, divisor, answer)
+		return nil
+	}
+
+	var steps []divisionStep
+	part := new(big.Int)
+	for i := range digits {
+		part.Mul(part, big.NewInt(10))
+		part.Add(part, big.NewInt(int64(digits[i]-'0')))
+		q := new(big.Int).Quo(part, divisor)
+		if len(steps) > 0 || q.Sign() > 0 {
+			product := new(big.Int).Mul(q, divisor)
+			rest := new(big.Int).Sub(part, product)
+			steps = append(steps, divisionStep{i, new(big.Int).Set(part), product, q.Int64(), rest})
+		}
+		part.Sub(part, new(big.Int).Mul(q, divisor))
+	}
+
+	label := divisor.String() + " )"
+	g := &sumGrid{margin: len(label), cols: len(digits)}
+	first := steps[0].end
+	g.row("", g.place(quotient.String(), g.cols-1, highlightGreen))
+	g.rule(first-len(steps[0].part.String())+1, g.cols-1)
+	g.row(label, g.place(digits, g.cols-1, nil))
+	var text []string
+	for n, s := range steps {
+		partDigits, productDigits := s.part.String(), s.product.String()
+		if n > 0 {
+			g.row("", g.place(partDigits, s.end, nil))
+		}
+		g.row("", g.place(productDigits, s.end, nil))
+		g.rule(s.end-len(partDigits)+1, s.end)
+		line := fmt.Sprintf("%s ÷ %s = %s. %s × %s = %s. %s - %s = %s.", partDigits, divisor, highlightGreen(fmt.Sprint(s.quotientDigit)), divisor, fmt.Sprint(s.quotientDigit), productDigits, partDigits, productDigits, s.remainderAfter)
+		if s.end+1 < len(digits) {
+			line += fmt.Sprintf(" Bring down the %c.", digits[s.end+1])
+		}
+		text = append(text, line)
+	}
+	g.row("", g.place(remainder.String(), g.cols-1, highlightYellow))
+	g.print(c)
+	for _, line := range text {
+		fmt.Fprintln(c.Stdout, line)
+	}
+	fmt.Fprintf(c.Stdout, "So %s ÷ %s = %s.\n", digits, divisor, answer)
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// numberPattern matches the numbers the math commands understand: whole
+// numbers like 42, decimals like 0.25 and fractions like 1/2.
+var numberPattern = regexp.MustCompile(`^[+-]?(\d+/\d+|\d+(\.\d*)?|\.\d+)$`)
+
+// number is a number the way a child typed it, like "3 1/4", and its value.
+type number struct {
+	text  string
+	value *big.Rat
+}
+
+// parseNumber parses one number. Commas between digits, as in 1,000, are
+// allowed.
+func parseNumber(s string) (*big.Rat, error) {
+	text := strings.ReplaceAll(strings.ReplaceAll(s, ",", ""), "−", "-")
+	if !numberPattern.MatchString(text) {
+		return nil, fmt.Errorf("%q is not a number I know", s)
+	}
+	if _, bottom, ok := strings.Cut(text, "/"); ok && strings.Trim(bottom, "0") == "" {
+		return nil, errDivideByZero
+	}
+	r, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a number I know", s)
+	}
+	return r, nil
+}
+
+// isProperFraction returns whether s is written like 1/4, with the top
+// smaller than the bottom, so that it can follow a whole number to make a
+// mixed number.
+func isProperFraction(s string) bool {
+	top, bottom, ok := strings.Cut(s, "/")
+	if !ok || !numberPattern.MatchString(s) || strings.ContainsAny(top, "+-") {
+		return false
+	}
+	t, _ := new(big.Int).SetString(top, 10)
+	b, _ := new(big.Int).SetString(bottom, 10)
+	return b.Sign() > 0 && t.Cmp(b) < 0
+}
+
+func isWholeNumber(s string) bool {
+	return numberPattern.MatchString(s) && !strings.ContainsAny(s, "./")
+}
+
+// parseNumbers parses the numbers in args. A whole number followed by a
+// fraction, like 3 1/4, is a mixed number, whether it comes as one
+// argument or two. Two arguments on their own, like subtract 1 1/3, are
+// always two numbers, because every math command needs at least two.
+func parseNumbers(args []string) ([]number, error) {
+	var fields []string
+	for _, arg := range args {
+		fields = append(fields, strings.Fields(arg)...)
+	}
+	mixed := len(args) != 2 || len(fields) != 2
+	var nums []number
+	for i := 0; i < len(fields); i++ {
+		v, err := parseNumber(fields[i])
+		if err != nil {
+			return nil, err
+		}
+		text := fields[i]
+		if mixed && i+1 < len(fields) && isWholeNumber(fields[i]) && isProperFraction(fields[i+1]) {
+			frac, _ := parseNumber(fields[i+1])
+			if v.Sign() < 0 || strings.HasPrefix(fields[i], "-") {
+				frac.Neg(frac)
+			}
+			v.Add(v, frac)
+			text += " " + fields[i+1]
+			i++
+		}
+		nums = append(nums, number{text, v})
+	}
+	return nums, nil
+}
+
+// Answers that aren't whole numbers are shown as mixed numbers like 3 1/4
+// or as decimals like 3.25, whichever the child picked with the fractions
+// command. Until they pick, answers look like the numbers they typed.
+const (
+	fractionsMixed    = "mixed"
+	fractionsDecimals = "decimals"
+)
+
+// useDecimals returns whether to show answers to a sum of texts as
+// decimals.
+func (c *CommandContext) useDecimals(texts ...string) bool {
+	switch c.Session.Fractions {
+	case fractionsMixed:
+		return false
+	case fractionsDecimals:
+		return true
+	}
+	decimals := false
+	for _, text := range texts {
+		if strings.Contains(text, "/") {
+			return false
+		}
+		if strings.Contains(text, ".") {
+			decimals = true
+		}
+	}
+	return decimals
+}
+
+func numberTexts(nums []number) []string {
+	texts := make([]string, len(nums))
+	for i, n := range nums {
+		texts[i] = n.text
+	}
+	return texts
+}
+
+// maxDecimalPlaces is how many places a decimal that goes on forever,
+// like 1/3, is shown to.
+const maxDecimalPlaces = 9
+
+// formatRat writes r as a decimal, or as a whole number and a fraction in
+// lowest terms.
+func formatRat(r *big.Rat, decimals bool) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	if decimals {
+		return formatDecimal(r)
+	}
+	whole, rest := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	frac := new(big.Int).Abs(rest).String() + "/" + r.Denom().String()
+	switch {
+	case whole.Sign() != 0:
+		return whole.String() + " " + frac
+	case r.Sign() < 0:
+		return "-" + frac
+	}
+	return frac
+}
+
+// formatDecimal writes r as a decimal. Decimals that go on forever are
+// rounded, and say so.
+func formatDecimal(r *big.Rat) string {
+	for places := 0; places <= maxDecimalPlaces; places++ {
+		s := r.FloatString(places)
+		if back, _ := new(big.Rat).SetString(s); back.Cmp(r) == 0 {
+			return s
+		}
+	}
+	return "about " + strings.TrimRight(r.FloatString(maxDecimalPlaces), "0")
+}
+
+func doFractions(c *CommandContext, args []string) error {
+	if len(args) == 0 {
+		switch c.Session.Fractions {
+		case fractionsMixed:
+			fmt.Fprintln(c.Stdout, "Answers are shown as mixed numbers, like 3 1/4.")
+		case fractionsDecimals:
+			fmt.Fprintln(c.Stdout, "Answers are shown as decimals, like 3.25.")
+		default:
+			fmt.Fprintln(c.Stdout, "Answers look like the numbers you type: 1/2 + 1/4 = 3/4, and 0.5 + 0.25 = 0.75.")
+		}
+		fmt.Fprintf(c.Stdout, "Type %sfractions mixed%s, %sfractions decimals%s or %sfractions auto%s to change it.\n", BoldText, NormalText, BoldText, NormalText, BoldText, NormalText)
+		return nil
+	}
+	switch args[0] {
+	case "mixed", "fractions":
+		c.Session.Fractions = fractionsMixed
+		fmt.Fprintln(c.Stdout, "OK! Answers will be mixed numbers, like 3 1/4.")
+	case "decimals", "decimal":
+		c.Session.Fractions = fractionsDecimals
+		fmt.Fprintln(c.Stdout, "OK! Answers will be decimals, like 3.25.")
+	case "auto":
+		c.Session.Fractions = ""
+		fmt.Fprintln(c.Stdout, "OK! Answers will look like the numbers you type.")
+	default:
+		return fmt.Errorf("fractions can be mixed, decimals or auto, not %q", args[0])
+	}
+	return nil
+}
+
+// sortNumbers sorts nums from smallest to largest, keeping numbers that
+// are equal in the order they were typed.
+func sortNumbers(nums []number) {
+	sort.SliceStable(nums, func(i, j int) bool {
+		return nums[i].value.Cmp(nums[j].value) < 0
+	})
+}
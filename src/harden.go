@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Limits are resource limits set when the shell starts. Zero leaves a
+// limit as it was.
+type Limits struct {
+	Processes  int `json:"processes"`
+	FileSizeMB int `json:"fileSizeMB"`
+	OpenFiles  int `json:"openFiles"`
+}
+
+const (
+	defaultFileSizeMB = 100
+	defaultOpenFiles  = 256
+)
+
+// protection is one of the ways the shell locks itself down at startup.
+type protection struct {
+	Name   string `json:"name"`
+	Active bool   `json:"active"`
+	Detail string `json:"detail"`
+}
+
+// protections are what harden managed to do, for the protections command.
+var protections []protection
+
+func addProtection(name string, active bool, format string, args ...interface{}) {
+	protections = append(protections, protection{name, active, fmt.Sprintf(format, args...)})
+}
+
+func (l Limits) validate() error {
+	if l.Processes < 0 {
+		return &ConfigError{"limits.processes", fmt.Errorf("must not be negative, got %d", l.Processes)}
+	}
+	if l.FileSizeMB < 0 {
+		return &ConfigError{"limits.fileSizeMB", fmt.Errorf("must not be negative, got %d", l.FileSizeMB)}
+	}
+	if l.OpenFiles < 0 {
+		return &ConfigError{"limits.openFiles", fmt.Errorf("must not be negative, got %d", l.OpenFiles)}
+	}
+	return nil
+}
+
+func doProtections(c *CommandContext, args []string) error {
+	if len(protections) == 0 {
+		fmt.Fprintln(c.Stdout, "The shell was started without any protections.")
+		return nil
+	}
+	for _, p := range protections {
+		status := fmt.Sprintf("%soff%s", BoldRedText, NormalText)
+		if p.Active {
+			status = fmt.Sprintf("%son%s ", BoldGreenText, NormalText)
+		}
+		fmt.Fprintf(c.Stdout, "%s  %-20s %s\n", status, p.Name, p.Detail)
+	}
+	return nil
+}
@@ -0,0 +1,418 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// protectionsEnv carries the list of protections across the exec in
+// harden.
+const protectionsEnv = "KIDSH_PROTECTIONS"
+
+const (
+	prSetSeccomp            = 22
+	prCapbsetDrop           = 24
+	prSetNoNewPrivs         = 38
+	prGetNoNewPrivs         = 39
+	prCapAmbient            = 47
+	prCapAmbientClearAll    = 4
+	seccompModeFilter       = 2
+	linuxCapabilityVersion3 = 0x20080522
+	rlimitNproc             = 6
+)
+
+func prctl(option, arg2, arg3 uintptr) (uintptr, error) {
+	r, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, option, arg2, arg3, 0, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return r, nil
+}
+
+func noNewPrivs() bool {
+	r, err := prctl(prGetNoNewPrivs, 0, 0)
+	return err == nil && r == 1
+}
+
+// harden locks the shell down before the child gets to type anything. It
+// switches away from root, drops capabilities, sets no_new_privs and
+// resource limits, and confines the shell with Landlock and seccomp where
+// the kernel has them.
+//
+// Capabilities, no_new_privs, Landlock and seccomp belong to a thread, and
+// the Go runtime has already started several. So they are set on one
+// locked thread, which then runs kidsh again with exec: every thread of
+// the new program starts out just as locked down.
+func harden(cfg *Config, profile string) error {
+	if report := os.Getenv(protectionsEnv); report != "" {
+		os.Unsetenv(protectionsEnv)
+		// Don't let the variable stand in for the real thing.
+		if noNewPrivs() {
+			return json.Unmarshal([]byte(report), &protections)
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	runtime.LockOSThread()
+	emptied := os.Geteuid() == 0 && dropBoundingSet() == nil
+	if err := switchUser(cfg.RunAsUser); err != nil {
+		return err
+	}
+	dropCapabilities(emptied)
+	if _, err := prctl(prSetNoNewPrivs, 1, 0); err != nil {
+		return fmt.Errorf("set no_new_privs: %v", err)
+	}
+	addProtection("no new privileges", true, "programs can't gain privileges, even setuid ones")
+	setLimits(cfg.Limits)
+	if cfg.Sandbox {
+		dir, err := profileDir(profile)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		landlock(cfg, dir, exe)
+		seccomp()
+	} else {
+		addProtection("landlock", false, "sandbox is false in the config")
+		addProtection("seccomp", false, "sandbox is false in the config")
+	}
+	report, err := json.Marshal(protections)
+	if err != nil {
+		return err
+	}
+	args := append([]string{os.Args[0], "-profile", profile}, os.Args[1:]...)
+	env := append(os.Environ(), protectionsEnv+"="+string(report))
+	return syscall.Exec(exe, args, env)
+}
+
+// dropBoundingSet removes every capability from the bounding set, so that
+// no program run later can get them back.
+func dropBoundingSet() error {
+	data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return err
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return err
+	}
+	for capability := 0; capability <= last; capability++ {
+		if _, err := prctl(prCapbsetDrop, uintptr(capability), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropCapabilities(emptiedBoundingSet bool) {
+	// Ambient capabilities are newer than some kernels.
+	_, _ = prctl(prCapAmbient, prCapAmbientClearAll, 0)
+	header := struct {
+		version uint32
+		pid     int32
+	}{linuxCapabilityVersion3, 0}
+	var data [2]struct{ effective, permitted, inheritable uint32 }
+	_, _, errno := syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0)
+	switch {
+	case errno != 0:
+		addProtection("capabilities", false, "could not drop them: %v", errno)
+	case emptiedBoundingSet:
+		addProtection("capabilities", true, "all dropped, and the bounding set is empty")
+	default:
+		addProtection("capabilities", true, "all dropped")
+	}
+}
+
+// switchUser changes to the account named in the config if the shell was
+// started as root.
+func switchUser(name string) error {
+	if name == "" {
+		if os.Geteuid() == 0 {
+			addProtection("unprivileged user", false, "running as root; set runAsUser in the config")
+		} else {
+			addProtection("unprivileged user", true, "running as uid %d", os.Geteuid())
+		}
+		return nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return fmt.Errorf("runAsUser: %v", err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("runAsUser: uid %q: %v", u.Uid, err)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("runAsUser: gid %q: %v", u.Gid, err)
+	}
+	if os.Geteuid() != 0 {
+		if os.Geteuid() != uid {
+			return fmt.Errorf("runAsUser: kidsh must be started as root or as %s", name)
+		}
+		addProtection("unprivileged user", true, "running as %s", name)
+		return nil
+	}
+	// The group has to go first, while we are still allowed to change it.
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("runAsUser: setgroups: %v", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("runAsUser: setgid: %v", err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("runAsUser: setuid: %v", err)
+	}
+	os.Setenv("HOME", u.HomeDir)
+	os.Setenv("USER", u.Username)
+	os.Setenv("LOGNAME", u.Username)
+	addProtection("unprivileged user", true, "switched from root to %s", name)
+	return nil
+}
+
+func setLimit(resource int, value uint64) error {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &limit); err != nil {
+		return err
+	}
+	if value < limit.Max {
+		limit.Max = value
+	}
+	limit.Cur = limit.Max
+	return syscall.Setrlimit(resource, &limit)
+}
+
+func setLimits(l Limits) {
+	var set []string
+	for _, r := range []struct {
+		name     string
+		resource int
+		value    int
+		unit     uint64
+	}{
+		{"processes", rlimitNproc, l.Processes, 1},
+		{"MB per file", syscall.RLIMIT_FSIZE, l.FileSizeMB, 1 << 20},
+		{"open files", syscall.RLIMIT_NOFILE, l.OpenFiles, 1},
+	} {
+		if r.value == 0 {
+			continue
+		}
+		if err := setLimit(r.resource, uint64(r.value)*r.unit); err != nil {
+			addProtection("resource limits", false, "%s: %v", r.name, err)
+			return
+		}
+		set = append(set, fmt.Sprintf("%d %s", r.value, r.name))
+	}
+	if len(set) == 0 {
+		addProtection("resource limits", false, "none are set in the config")
+		return
+	}
+	addProtection("resource limits", true, "%s", strings.Join(set, ", "))
+}
+
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1
+	landlockRulePathBeneath      = 1
+)
+
+// Landlock filesystem access rights.
+const (
+	fsExecute = 1 << iota
+	fsWriteFile
+	fsReadFile
+	fsReadDir
+	fsRemoveDir
+	fsRemoveFile
+	fsMakeChar
+	fsMakeDir
+	fsMakeReg
+	fsMakeSock
+	fsMakeFifo
+	fsMakeBlock
+	fsMakeSym
+	fsRefer    // ABI 2
+	fsTruncate // ABI 3
+
+	fsFileRights = fsExecute | fsWriteFile | fsReadFile | fsTruncate
+	fsRead       = fsReadFile | fsReadDir
+	fsReadWrite  = fsRead | fsWriteFile | fsMakeReg | fsRemoveFile | fsTruncate
+)
+
+type landlockPathBeneath struct {
+	allowedAccess uint64
+	parentFd      int32
+}
+
+// landlock only lets the shell change files in the child's state
+// directory, the config file and the audit log, read the system and the
+// family files, and run itself and the allowed programs.
+func landlock(cfg *Config, dir, exe string) {
+	abi, _, errno := syscall.RawSyscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		addProtection("landlock", false, "the kernel doesn't have it: %v", errno)
+		return
+	}
+	handled := uint64(fsMakeSym<<1 - 1)
+	if abi >= 2 {
+		handled |= fsRefer
+	}
+	if abi >= 3 {
+		handled |= fsTruncate
+	}
+	attr := struct{ handledAccessFS uint64 }{handled}
+	fd, _, errno := syscall.RawSyscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		addProtection("landlock", false, "create ruleset: %v", errno)
+		return
+	}
+	defer syscall.Close(int(fd))
+
+	rules := map[string]uint64{
+		"/usr":       fsRead,
+		"/etc":       fsRead,
+		"/bin":       fsRead,
+		"/lib":       fsRead | fsExecute,
+		"/lib64":     fsRead | fsExecute,
+		"/usr/lib":   fsRead | fsExecute,
+		"/usr/lib64": fsRead | fsExecute,
+		"/proc":      fsRead,
+		"/sys":       fsRead,
+		"/dev":       fsRead | fsWriteFile,
+		exe:          fsReadFile | fsExecute,
+		// All the profiles, not just dir, so that admin can clear another
+		// child's todo list.
+		filepath.Dir(dir): fsReadWrite | fsMakeDir | fsRemoveDir | fsRefer,
+	}
+	addPath := func(path string, access uint64) {
+		if abs, err := filepath.Abs(path); err == nil {
+			rules[abs] |= access
+		}
+	}
+	if flag.NArg() > 0 {
+		// The script to run is opened after the shell restarts sandboxed.
+		addPath(flag.Arg(0), fsReadFile)
+	}
+	addPath(cfg.ContactsVCFFile, fsReadFile)
+	addPath(cfg.FamilyInfoFile, fsReadFile)
+	addPath(filepath.Dir(cfg.AuditLogFile), fsReadWrite)
+	if configPath != "" {
+		addPath(filepath.Dir(configPath), fsReadWrite)
+	} else {
+		addPath(filepath.Dir(filepath.Dir(userConfigPath())), fsRead|fsMakeDir)
+		addPath(filepath.Dir(userConfigPath()), fsReadWrite)
+	}
+	if flags.Strict {
+		for _, program := range cfg.AllowedPrograms {
+			addPath(program, fsReadFile|fsExecute)
+		}
+	} else {
+		for _, path := range []string{"/usr", "/bin", "/sbin"} {
+			rules[path] |= fsExecute
+		}
+	}
+
+	for path, access := range rules {
+		pathFd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			continue // It's fine for these not to exist.
+		}
+		var st syscall.Stat_t
+		if syscall.Fstat(pathFd, &st) == nil && st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+			access &= fsFileRights
+		}
+		rule := landlockPathBeneath{access & handled, int32(pathFd)}
+		_, _, errno := syscall.RawSyscall6(sysLandlockAddRule, fd, landlockRulePathBeneath, uintptr(unsafe.Pointer(&rule)), 0, 0, 0)
+		syscall.Close(pathFd)
+		if errno != 0 {
+			addProtection("landlock", false, "add rule for %s: %v", path, errno)
+			return
+		}
+	}
+	if _, _, errno := syscall.RawSyscall(sysLandlockRestrictSelf, fd, 0, 0); errno != 0 {
+		addProtection("landlock", false, "restrict: %v", errno)
+		return
+	}
+	addProtection("landlock", true, "ABI %d; files can only be changed in %s", abi, filepath.Dir(dir))
+}
+
+// seccompDenied are system calls a shell for children has no business
+// making.
+var seccompDenied = []uintptr{
+	syscall.SYS_ACCT,
+	syscall.SYS_ADD_KEY,
+	syscall.SYS_CHROOT,
+	syscall.SYS_DELETE_MODULE,
+	syscall.SYS_INIT_MODULE,
+	syscall.SYS_KEXEC_LOAD,
+	syscall.SYS_KEYCTL,
+	syscall.SYS_MOUNT,
+	syscall.SYS_PERF_EVENT_OPEN,
+	syscall.SYS_PIVOT_ROOT,
+	syscall.SYS_PTRACE,
+	syscall.SYS_REBOOT,
+	syscall.SYS_REQUEST_KEY,
+	syscall.SYS_SETDOMAINNAME,
+	syscall.SYS_SETHOSTNAME,
+	syscall.SYS_SETTIMEOFDAY,
+	syscall.SYS_SWAPOFF,
+	syscall.SYS_SWAPON,
+	syscall.SYS_UMOUNT2,
+	syscall.SYS_UNSHARE,
+}
+
+const (
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+
+	// x32 system calls on amd64 have this bit set.
+	x32SyscallBit = 0x40000000
+)
+
+// seccomp makes the system calls in seccompDenied fail with EPERM.
+func seccomp() {
+	if seccompArch == 0 {
+		addProtection("seccomp", false, "not supported on %s", runtime.GOARCH)
+		return
+	}
+	n := uint8(len(seccompDenied))
+	filter := []syscall.SockFilter{
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: 4}, // arch
+		{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, Jt: 1, K: seccompArch},
+		{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetKillProcess},
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: 0}, // nr
+		{Code: syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K, Jt: n + 1, K: x32SyscallBit},
+	}
+	for i, nr := range seccompDenied {
+		filter = append(filter, syscall.SockFilter{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, Jt: n - uint8(i), K: uint32(nr)})
+	}
+	filter = append(filter,
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetAllow},
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetErrno | uint32(syscall.EPERM)},
+	)
+	prog := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if _, err := prctl(prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog))); err != nil {
+		addProtection("seccomp", false, "%v", err)
+		return
+	}
+	addProtection("seccomp", true, "%d dangerous system calls are blocked", len(seccompDenied))
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// harden only knows how to lock the shell down on Linux.
+func harden(cfg *Config, profile string) error {
+	if cfg.RunAsUser != "" {
+		return fmt.Errorf("runAsUser only works on Linux")
+	}
+	addProtection("sandbox", false, "kidsh can only lock itself down on Linux")
+	return nil
+}
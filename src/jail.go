@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// jailDirName is the directory in a profile's state directory that the
+// child sees as /.
+const jailDirName = "files"
+
+// myStuff is the folder the child starts out in.
+const myStuff = "/My Stuff"
+
+var (
+	errAboveRoot   = errors.New("you can't go above /")
+	errOutsideJail = errors.New("that leads outside your files")
+)
+
+func (s *Session) jailRoot() string {
+	return filepath.Join(s.Dir, jailDirName)
+}
+
+// openJail creates the child's files and My Stuff, and goes back to My
+// Stuff if the current directory is gone.
+func (s *Session) openJail() error {
+	if err := os.MkdirAll(filepath.Join(s.jailRoot(), filepath.FromSlash(myStuff)), 0700); err != nil {
+		return err
+	}
+	// Todo lists used to be kept next to session.json.
+	if todo, err := s.todoPath(defaultTodoFile); err == nil {
+		if _, err := os.Stat(todo); os.IsNotExist(err) {
+			_ = os.Rename(filepath.Join(s.Dir, defaultTodoFile), todo)
+		}
+	}
+	if host, err := s.hostPath(s.cwd()); err != nil || !isDir(host) {
+		s.Cwd = myStuff
+	}
+	return nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func (s *Session) cwd() string {
+	if s.Cwd == "" {
+		return myStuff
+	}
+	return s.Cwd
+}
+
+// virtualPath turns p, which may be relative to the current directory,
+// into a clean absolute path inside the jail.
+func (s *Session) virtualPath(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		p = s.cwd() + "/" + p
+	}
+	var parts []string
+	for _, part := range strings.Split(p, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if len(parts) == 0 {
+				return "", errAboveRoot
+			}
+			parts = parts[:len(parts)-1]
+		default:
+			parts = append(parts, part)
+		}
+	}
+	return path.Join("/", strings.Join(parts, "/")), nil
+}
+
+// hostPath returns where the virtual path p really is. Symbolic links
+// are followed as far as the path exists, and must stay inside the jail.
+func (s *Session) hostPath(p string) (string, error) {
+	root, err := filepath.EvalSymlinks(s.jailRoot())
+	if err != nil {
+		return "", err
+	}
+	existing := filepath.Join(root, filepath.FromSlash(p))
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			existing = resolved
+			break
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		// A link to something that doesn't exist could still point out.
+		if info, err := os.Lstat(existing); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", errOutsideJail
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = filepath.Dir(existing)
+	}
+	if existing != root && !strings.HasPrefix(existing, root+string(filepath.Separator)) {
+		return "", errOutsideJail
+	}
+	return filepath.Join(existing, rest), nil
+}
+
+// resolve returns the virtual path and the host path of p. Errors only
+// mention the virtual path.
+func (c *CommandContext) resolve(p string) (string, string, error) {
+	virtual, err := c.Session.virtualPath(p)
+	if err != nil {
+		return "", "", err
+	}
+	host, err := c.Session.hostPath(virtual)
+	if err != nil {
+		return "", "", pathError(err, virtual)
+	}
+	return virtual, host, nil
+}
+
+// pathError is err with the host path swapped for the virtual one, so the
+// child never sees where their files really are.
+func pathError(err error, virtual string) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return &fs.PathError{Op: pe.Op, Path: virtual, Err: pe.Err}
+	}
+	return err
+}
+
+// todoPath returns where the todo list named todoFile is kept.
+func (s *Session) todoPath(todoFile string) (string, error) {
+	return s.hostPath(path.Join("/", filepath.ToSlash(todoFile)))
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const historyFileName = "history"
+
+// Only this many history entries are kept.
+const historyLimit = 500
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyReturn    = 13
+	keyCtrlQ     = 17
+	keyCtrlS     = 19
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// errInterrupted is returned by readLine when Ctrl-C abandons the line.
+var errInterrupted = errors.New("interrupted")
+
+// terminal is the keyboard. Everything typed is read through one buffer,
+// shared by the line editor and the builtins that ask questions, so that
+// keys typed ahead of a prompt aren't lost between them.
+type terminal struct {
+	file   *os.File
+	reader *bufio.Reader
+	ctx    context.Context // While reading keys, reads stop when it is done.
+}
+
+func newTerminal(f *os.File) *terminal {
+	t := &terminal{file: f}
+	t.reader = bufio.NewReader(keyReader{t})
+	return t
+}
+
+// keyPoll is how long a terminal waits for a key before checking whether
+// it should stop waiting.
+const keyPoll = 100 * time.Millisecond
+
+// keyReader reads the terminal file. While the terminal is reading keys,
+// it waits until a key is pressed, the context is done or the terminal
+// hangs up.
+type keyReader struct {
+	t *terminal
+}
+
+func (r keyReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.t.file.Read(p)
+		if n > 0 || err != io.EOF || r.t.ctx == nil {
+			return n, err
+		}
+		if err := r.t.ctx.Err(); err != nil {
+			return 0, err
+		}
+		if hungUp.Load() {
+			return 0, io.EOF
+		}
+	}
+}
+
+// readKeys puts the terminal in raw mode, to read keys one at a time until
+// ctx is done, and returns a function that puts it back.
+func (t *terminal) readKeys(ctx context.Context) (func(), error) {
+	fd := int(t.file.Fd())
+	state, err := makeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	if err := setReadTimeout(fd, keyPoll); err != nil {
+		restoreTerminal(fd, state)
+		return nil, err
+	}
+	t.ctx = ctx
+	return func() {
+		t.ctx = nil
+		restoreTerminal(fd, state)
+	}, nil
+}
+
+func (t *terminal) Read(p []byte) (int, error) {
+	return t.reader.Read(p)
+}
+
+func (t *terminal) Fd() uintptr {
+	return t.file.Fd()
+}
+
+// terminalFd returns the file descriptor of r if it is a terminal.
+func terminalFd(r io.Reader) (int, bool) {
+	f, ok := r.(interface{ Fd() uintptr })
+	if !ok || !isTerminal(int(f.Fd())) {
+		return 0, false
+	}
+	return int(f.Fd()), true
+}
+
+// lineEditor reads lines from a terminal in raw mode so that the cursor
+// keys, history and tab completion work.
+type lineEditor struct {
+	in          *terminal
+	reader      *bufio.Reader
+	out         io.Writer
+	history     []string
+	historyFile string
+	complete    func(prefix string) []string
+
+	line []rune
+	pos  int
+}
+
+// newLineEditor returns a line editor that keeps its history in the
+// session's state directory and completes the commands it may run.
+func newLineEditor(in *terminal, out io.Writer, s *Session) *lineEditor {
+	e := &lineEditor{
+		in:          in,
+		reader:      in.reader,
+		out:         out,
+		historyFile: filepath.Join(s.Dir, historyFileName),
+		complete: func(prefix string) []string {
+			return completeCommand(s.Profile, prefix)
+		},
+	}
+	e.loadHistory()
+	return e
+}
+
+// completeCommand returns the command names and aliases starting with
+// prefix that profile may run, sorted.
+func completeCommand(profile, prefix string) []string {
+	var matches []string
+	for name, cmd := range cmds {
+		if strings.HasPrefix(name, prefix) && config.commandAllowed(profile, cmd) {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func (e *lineEditor) loadHistory() {
+	data, err := os.ReadFile(e.historyFile)
+	if err != nil {
+		return
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > historyLimit {
+		lines = lines[len(lines)-historyLimit:]
+		_ = os.WriteFile(e.historyFile, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	}
+	for _, line := range lines {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+}
+
+func (e *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > historyLimit {
+		e.history = e.history[1:]
+	}
+	if e.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// refresh redraws the prompt and the line, then puts the cursor back.
+func (e *lineEditor) refresh(prompt string) {
+	fmt.Fprintf(e.out, "\r%s%s\033[K", prompt, string(e.line))
+	if back := len(e.line) - e.pos; back > 0 {
+		fmt.Fprintf(e.out, "\033[%dD", back)
+	}
+}
+
+func (e *lineEditor) setLine(s string) {
+	e.line = []rune(s)
+	e.pos = len(e.line)
+}
+
+func (e *lineEditor) insert(r rune) {
+	e.line = append(e.line, 0)
+	copy(e.line[e.pos+1:], e.line[e.pos:])
+	e.line[e.pos] = r
+	e.pos++
+}
+
+// tabComplete completes the command name under the cursor. Arguments are
+// not completed.
+func (e *lineEditor) tabComplete(prompt string) {
+	word := string(e.line[:e.pos])
+	if strings.IndexFunc(word, unicode.IsSpace) >= 0 {
+		return
+	}
+	matches := e.complete(word)
+	switch len(matches) {
+	case 0:
+		fmt.Fprint(e.out, "\a")
+		return
+	case 1:
+		rest := strings.TrimPrefix(matches[0], word) + " "
+		for _, r := range rest {
+			e.insert(r)
+		}
+		return
+	}
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(common) > len(word) {
+		for _, r := range strings.TrimPrefix(common, word) {
+			e.insert(r)
+		}
+		return
+	}
+	fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(matches, "  "))
+	e.refresh(prompt)
+}
+
+// readEscape reads the rest of an escape sequence after ESC and returns
+// it, e.g. "[A" for the up arrow.
+func (e *lineEditor) readEscape() (string, error) {
+	r, _, err := e.reader.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	if r != '[' && r != 'O' {
+		return string(r), nil
+	}
+	seq := []rune{r}
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		seq = append(seq, r)
+		if r >= 0x40 && r <= 0x7E {
+			return string(seq), nil
+		}
+	}
+}
+
+// readLine shows prompt and reads one line. It returns io.EOF if Ctrl-D is
+// pressed on an empty line, errInterrupted if Ctrl-C is pressed and
+// ctx.Err() if ctx is done first.
+func (e *lineEditor) readLine(ctx context.Context, prompt string) (string, error) {
+	restore, err := e.in.readKeys(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	return e.editLine(prompt)
+}
+
+// editLine reads keys from a terminal that is already in raw mode until
+// the line is finished.
+func (e *lineEditor) editLine(prompt string) (string, error) {
+	e.line = e.line[:0]
+	e.pos = 0
+	historyIndex := len(e.history)
+	pending := ""
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case keyReturn, keyLineFeed:
+			fmt.Fprint(e.out, "\r\n")
+			line := string(e.line)
+			e.addHistory(line)
+			return line, nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if e.pos < len(e.line) {
+				e.line = append(e.line[:e.pos], e.line[e.pos+1:]...)
+			}
+		case keyDelete, keyBackspace:
+			if e.pos > 0 {
+				e.line = append(e.line[:e.pos-1], e.line[e.pos:]...)
+				e.pos--
+			}
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.line)
+		case keyCtrlU:
+			e.line = e.line[:0]
+			e.pos = 0
+		case keyTab:
+			e.tabComplete(prompt)
+		case keyEscape:
+			seq, err := e.readEscape()
+			if err != nil {
+				return "", err
+			}
+			switch seq {
+			case "[D", "OD": // Left
+				if e.pos > 0 {
+					e.pos--
+				}
+			case "[C", "OC": // Right
+				if e.pos < len(e.line) {
+					e.pos++
+				}
+			case "[H", "OH", "[1~", "[7~": // Home
+				e.pos = 0
+			case "[F", "OF", "[4~", "[8~": // End
+				e.pos = len(e.line)
+			case "[3~": // Delete
+				if e.pos < len(e.line) {
+					e.line = append(e.line[:e.pos], e.line[e.pos+1:]...)
+				}
+			case "[A", "OA": // Up
+				if historyIndex == 0 {
+					break
+				}
+				if historyIndex == len(e.history) {
+					pending = string(e.line)
+				}
+				historyIndex--
+				e.setLine(e.history[historyIndex])
+			case "[B", "OB": // Down
+				if historyIndex == len(e.history) {
+					break
+				}
+				historyIndex++
+				if historyIndex == len(e.history) {
+					e.setLine(pending)
+				} else {
+					e.setLine(e.history[historyIndex])
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				e.insert(r)
+			}
+		}
+		e.refresh(prompt)
+	}
+}
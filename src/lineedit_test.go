@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func testLineEditor(keys string, history ...string) *lineEditor {
+	return &lineEditor{
+		reader:  bufio.NewReader(strings.NewReader(keys)),
+		out:     io.Discard,
+		history: history,
+		complete: func(prefix string) []string {
+			var matches []string
+			for _, name := range []string{"colors", "count", "countgame"} {
+				if strings.HasPrefix(name, prefix) {
+					matches = append(matches, name)
+				}
+			}
+			return matches
+		},
+	}
+}
+
+func TestLineEditorKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{"enter", "cat\r", "cat"},
+		{"line feed", "cat\n", "cat"},
+		{"delete", "cas\x7ft\r", "cat"},
+		{"backspace", "cas\bt\r", "cat"},
+		{"backspace at start", "\x7f\bcat\r", "cat"},
+		{"left", "ct\x1b[Da\r", "cat"},
+		{"left and right", "ca\x1b[D\x1b[D\x1b[C\x1b[Ct\r", "cat"},
+		{"home and end", "at\x1b[Hc\x1b[F!\r", "cat!"},
+		{"ctrl-a and ctrl-e", "at\x01c\x05!\r", "cat!"},
+		{"delete key", "cxat\x1b[D\x1b[D\x1b[D\x1b[3~\r", "cat"},
+		{"ctrl-d deletes", "cxat\x01\x1bOC\x04\r", "cat"},
+		{"ctrl-u", "dog\x15cat\r", "cat"},
+		{"up", "\x1b[A\r", "two"},
+		{"up twice", "\x1b[A\x1b[A\r", "one"},
+		{"up past the oldest", "\x1b[A\x1b[A\x1b[A\r", "one"},
+		{"up and down", "\x1b[A\x1b[A\x1b[B\r", "two"},
+		{"down back to the new line", "new\x1b[A\x1bOB\r", "new"},
+		{"tab one match", "col\t\r", "colors "},
+		{"tab common prefix", "cou\tg\t\r", "countgame "},
+		{"tab many matches", "co\t\r", "co"},
+		{"tab after a word", "say col\t\r", "say col"},
+	}
+	for _, tt := range tests {
+		e := testLineEditor(tt.keys, "one", "two")
+		got, err := e.editLine("> ")
+		if err != nil || got != tt.want {
+			t.Errorf("%s: editLine(%q) = %q, %v, want %q", tt.name, tt.keys, got, err, tt.want)
+		}
+	}
+}
+
+func TestLineEditorCtrlCAndCtrlD(t *testing.T) {
+	if _, err := testLineEditor("cat\x03").editLine("> "); err != errInterrupted {
+		t.Errorf("Ctrl-C: got %v, want errInterrupted", err)
+	}
+	if _, err := testLineEditor("\x04").editLine("> "); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line: got %v, want io.EOF", err)
+	}
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	e := testLineEditor("one\rtwo\rtwo\r   \r\x1b[A\x1b[A\r")
+	for i := 0; i < 4; i++ {
+		if _, err := e.editLine("> "); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(e.history, ","); got != "one,two" {
+		t.Errorf("history = %s, want one,two", got)
+	}
+	if got, _ := e.editLine("> "); got != "one" {
+		t.Errorf("up twice = %q, want one", got)
+	}
+}
+
+// TestTerminalSharesTypeAhead types a command and the answer to its
+// question at once, and checks the answer is still there for the question.
+func TestTerminalSharesTypeAhead(t *testing.T) {
+	term := &terminal{reader: bufio.NewReader(strings.NewReader("drill\r4\r"))}
+	e := testLineEditor("")
+	e.in, e.reader = term, term.reader
+	if line, err := e.editLine("> "); line != "drill" || err != nil {
+		t.Fatalf("editLine = %q, %v, want drill", line, err)
+	}
+	c, _ := newTestContext(t, "")
+	c.Stdin = term
+	if answer, err := readAnswer(c, "2 × 2 = "); answer != "4" || err != nil {
+		t.Errorf("readAnswer = %q, %v, want 4", answer, err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// loginSessionEnv is set for the shell sessions that a login shell starts.
+const loginSessionEnv = "KIDSH_LOGIN_SESSION"
+
+// respawnDelay is how long to wait before starting a session again if the
+// last one ended as soon as it started, so a broken config doesn't spin.
+const respawnDelay = time.Second
+
+// isLoginShell returns whether kidsh is a login shell, either because it
+// was started with -login or because login(1) started it with a "-" in
+// front of its name.
+func isLoginShell() bool {
+	return flags.Login || strings.HasPrefix(os.Args[0], "-")
+}
+
+// isLoginSession returns whether this is a session started by a login
+// shell.
+func isLoginSession() bool {
+	return os.Getenv(loginSessionEnv) != ""
+}
+
+// superviseLogin runs shell sessions one after another, each in its own
+// process, and returns the exit code for the login shell. A session that
+// crashes is started again, with the terminal put back the way it was. A
+// session that exits cleanly ends the login shell, unless it is PID 1, in
+// which case a fresh session starts. As PID 1 it also reaps orphaned
+// processes.
+func superviseLogin() int {
+	handleSignals()
+	exe, err := os.Executable()
+	if err != nil {
+		log.Printf("login: %v", err)
+		return 1
+	}
+	fd := int(os.Stdin.Fd())
+	saved, err := saveTerminal(fd)
+	if err != nil {
+		saved = nil
+	}
+	for !hungUp.Load() {
+		fmt.Print(clearScreen)
+		cmd := exec.Command(exe, os.Args[1:]...)
+		cmd.Args[0] = os.Args[0]
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), loginSessionEnv+"=1")
+		start := time.Now()
+		if err := cmd.Start(); err != nil {
+			log.Printf("login: start session: %v", err)
+			return 1
+		}
+		code, err := waitSession(cmd)
+		if saved != nil {
+			restoreTerminal(fd, saved)
+		}
+		if err != nil {
+			log.Printf("login: wait for session: %v", err)
+			return 1
+		}
+		if code == 0 && os.Getpid() != 1 {
+			return 0
+		}
+		if code != 0 {
+			log.Printf("login: session ended with status %d; starting a new one", code)
+		}
+		if time.Since(start) < respawnDelay {
+			time.Sleep(respawnDelay)
+		}
+	}
+	return 0
+}
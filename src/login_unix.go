@@ -0,0 +1,28 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// waitSession waits for the session cmd and returns its exit status, or -1
+// if it was killed. Any other process that exits meanwhile is reaped too,
+// which matters when the login shell is PID 1 and inherits orphans.
+func waitSession(cmd *exec.Cmd) (int, error) {
+	defer cmd.Process.Release()
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return -1, err
+		}
+		if pid == cmd.Process.Pid {
+			return status.ExitStatus(), nil
+		}
+	}
+}
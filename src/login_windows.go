@@ -0,0 +1,17 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// waitSession waits for the session cmd and returns its exit status, or -1
+// if it was killed.
+func waitSession(cmd *exec.Cmd) (int, error) {
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return -1, err
+	}
+	return cmd.ProcessState.ExitCode(), nil
+}
@@ -2,28 +2,47 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"os"
-	"os/exec"
+	"runtime/debug"
 	"strings"
 )
 
 var flags struct {
+	ConfigFile          string
+	Profile             string
+	SetPin              bool
+	Now                 string
+	Seed                int64
 	DryRun              bool
 	ExitOnError         bool
 	Verbose             bool
 	PrintVersionAndExit bool
+	Strict              bool
+	Login               bool
 }
 
 const appName = "kidsh"
 
 var (
 	version        = "1.0.0"
+	config         *Config
+	configPath     string
+	session        *Session
+	clock          Clock
+	random         *rand.Rand
 	nonzeroExit    bool
 	commandReader  io.Reader
+	commandInput   io.Reader = os.Stdin
+	commandOutput  io.Writer = os.Stdout
+	commandErrors  io.Writer = os.Stderr
 	postionalArg0  string
 	positionalArgs []string
 )
@@ -31,11 +50,17 @@ var (
 func init() {
 	log.SetOutput(os.Stderr)
 	log.SetFlags(0)
+	flag.StringVar(&flags.ConfigFile, "config", "", "path to the config file")
+	flag.StringVar(&flags.Profile, "profile", "", "the child using the shell")
+	flag.BoolVar(&flags.SetPin, "set-pin", false, "set the parent PIN and exit")
 	flag.BoolVar(&flags.PrintVersionAndExit, "version", false, "print version and exit")
 	flag.BoolVar(&flags.Verbose, "v", false, "verbose")
 	flag.BoolVar(&flags.ExitOnError, "e", false, "exit on error")
 	flag.BoolVar(&flags.DryRun, "n", false, "dry-run")
-	flag.Parse()
+	flag.BoolVar(&flags.Strict, "strict", true, "only run builtins and allowlisted programs")
+	flag.Int64Var(&flags.Seed, "seed", 0, "seed for random numbers, or 0 for a random seed")
+	flag.BoolVar(&flags.Login, "login", false, "run as a login shell, starting a new session whenever one ends")
+	flag.StringVar(&flags.Now, "now", "", "pretend the time is now this, like 2026-12-25T08:00")
 }
 
 func onExecuteError(command []string, err error) {
@@ -46,7 +71,29 @@ func onExecuteError(command []string, err error) {
 	}
 }
 
-func execute(command []string) {
+// panicError is a builtin that panicked, with where it happened.
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// runBuiltin runs builtin, turning a panic into a *panicError so that one
+// broken command doesn't take the whole shell down with it.
+func runBuiltin(c *CommandContext, builtin *Command, args []string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &panicError{r, debug.Stack()}
+			fmt.Fprintf(c.Stderr, "%sOops, something went wrong with %s.%s It's not your fault! Try something else.\n", YellowText, builtin.Name, NormalText)
+		}
+	}()
+	return builtin.Func(c, args)
+}
+
+func execute(c *CommandContext, command []string) {
 	if len(command) == 0 {
 		return
 	}
@@ -59,26 +106,209 @@ func execute(command []string) {
 		return
 	}
 	if builtin, ok := cmds[name]; ok {
-		if err := builtin.Func(args); err != nil {
+		if !c.Config.commandAllowed(c.Session.Profile, builtin) {
+			nonzeroExit = true
+			c.auditDenied(command, "turned off")
+			fmt.Fprintf(c.Stdout, "Sorry, %q is turned off for you.\n", name)
+			return
+		}
+		start := c.Clock.Now()
+		err := runBuiltin(c, builtin, args)
+		took := c.Clock.Now().Sub(start)
+		if c.Ctx.Err() != nil || errors.Is(err, errInterrupted) {
+			err = errInterrupted
+		}
+		c.audit(command, took, err)
+		c.Session.chargeUsage(start, builtin.Category, took)
+		c.Session.LastCategory = builtin.Category
+		if err == errInterrupted {
+			// Ctrl-C just goes back to the prompt.
+			fmt.Fprintln(c.Stdout)
+			return
+		}
+		var perr *panicError
+		if errors.As(err, &perr) {
+			// The child has been told; the stack is in the audit log.
+			nonzeroExit = true
+			if flags.Verbose {
+				log.Printf("execute %v: %v\n%s", command, perr, perr.stack)
+			}
+			if flags.ExitOnError {
+				log.Fatalf("exiting on error")
+			}
+			return
+		}
+		if err != nil {
 			onExecuteError(command, fmt.Errorf("builtin %q: %v", name, err))
 		}
 		return
 	}
-	cmd := exec.Command(name, args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+	cmd, ok := programCommand(c, name, args...)
+	if !ok {
+		nonzeroExit = true
+		fmt.Fprintf(c.Stdout, "I don't know the word %q. Type %shelp%s to see the words I know.\n", name, BoldText, NormalText)
+		return
+	}
+	cmd.Stdin = c.Stdin
+	if t, ok := c.Stdin.(*terminal); ok {
+		// Give the program the terminal itself, not a copy of what is typed.
+		cmd.Stdin = t.file
+	}
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	start := c.Clock.Now()
+	err := cmd.Run()
+	took := c.Clock.Now().Sub(start)
+	if c.Ctx.Err() != nil {
+		err = errInterrupted
+	}
+	c.audit(command, took, err)
+	c.Session.chargeUsage(start, "", took)
+	c.Session.LastCategory = ""
+	if err == errInterrupted {
+		fmt.Fprintln(c.Stdout)
+		return
+	}
+	if err != nil {
 		onExecuteError(command, err)
 	}
 }
 
+// executePipeline runs each command in turn, feeding the output of one
+// into the input of the next.
+func executePipeline(pipeline [][]string) {
+	ctx, done := commandContext()
+	defer done()
+	c := &CommandContext{
+		Ctx:     ctx,
+		Config:  config,
+		Session: session,
+		Clock:   clock,
+		Rand:    random,
+		Stdin:   commandInput,
+		Stdout:  commandOutput,
+		Stderr:  commandErrors,
+	}
+	if !checkBedtime(c, pipeline) || !checkBudget(c, pipeline) {
+		return
+	}
+	var cancel context.CancelFunc
+	c.Ctx, cancel = lockContext(c.Ctx, pipeline)
+	defer cancel()
+	for i, command := range pipeline {
+		var output bytes.Buffer
+		c.PipedOut = i < len(pipeline)-1
+		if c.PipedOut {
+			c.Stdout = &output
+		} else {
+			c.Stdout = commandOutput
+		}
+		execute(c, command)
+		if c.Ctx.Err() != nil {
+			break
+		}
+		c.Stdin = &output
+		c.PipedIn = true
+	}
+	if c.Ctx.Err() == context.DeadlineExceeded {
+		// The shell locked while the command was running.
+		c.Stdout = commandOutput
+		if checkBedtime(c, nil) {
+			showBudgetUsedUp(c, pipeline)
+		}
+	}
+	c.Session.LastActive = c.Clock.Now()
+}
+
+// lockContext returns a context that is done when the shell locks, at
+// bedtime or when pipeline uses up a screen-time budget, so that a command
+// or a prompt waiting for keys stops then.
+func lockContext(parent context.Context, pipeline [][]string) (context.Context, context.CancelFunc) {
+	now := clock.Now()
+	deadline, ok := bedtimeDeadline(config, session, now)
+	if budget, budgeted := budgetDeadline(config, session, pipeline, now); budgeted && (!ok || budget.Before(deadline)) {
+		deadline, ok = budget, true
+	}
+	if ok {
+		return context.WithTimeout(parent, deadline.Sub(now))
+	}
+	return context.WithCancel(parent)
+}
+
+func executeLine(line string) {
+	pipeline, err := parsePipeline(line, session.lookupVariable)
+	if perr, ok := err.(*ParseError); ok {
+		nonzeroExit = true
+		showParseError(commandOutput, line, perr)
+		if flags.ExitOnError {
+			log.Fatalf("exiting on error")
+		}
+		return
+	}
+	executePipeline(pipeline)
+	if err := session.save(); err != nil {
+		log.Printf("save session: %v", err)
+	}
+}
+
+const prompt = GreenText + ">>> " + NormalText
+
 func executeFromReader(r io.Reader) {
-	os.Stdout.Write([]byte(GreenText + ">>> " + NormalText))
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		execute(strings.Fields(scanner.Text()))
-		os.Stdout.Write([]byte(GreenText + ">>> " + NormalText))
+	if f, ok := r.(*os.File); ok && isTerminal(int(f.Fd())) {
+		t := newTerminal(f)
+		if r == os.Stdin {
+			commandInput = t
+		}
+		executeFromTerminal(t)
+		return
+	}
+	reader := bufio.NewReader(r)
+	if r == os.Stdin {
+		// Builtins that ask questions read the lines after theirs, so
+		// they must share the buffer the commands are read from.
+		commandInput = reader
+	}
+	os.Stdout.Write([]byte(prompt))
+	for !hungUp.Load() {
+		line, err := reader.ReadString('\n')
+		if line == "" && err != nil {
+			if err != io.EOF {
+				log.Printf("read command: %v", err)
+			}
+			return
+		}
+		executeLine(strings.TrimRight(line, "\r\n"))
+		os.Stdout.Write([]byte(prompt))
+	}
+}
+
+func executeFromTerminal(t *terminal) {
+	editor := newLineEditor(t, os.Stdout, session)
+	// Say goodnight straight away if the shell is started after bedtime.
+	executePipeline(nil)
+	for !hungUp.Load() {
+		ctx, cancel := lockContext(context.Background(), nil)
+		line, err := editor.readLine(ctx, prompt)
+		cancel()
+		switch {
+		case err == context.DeadlineExceeded:
+			// Bedtime came, or screen time ran out, while waiting for a
+			// command.
+			fmt.Println()
+			executePipeline(nil)
+			continue
+		case err == errInterrupted:
+			continue
+		case err == io.EOF && config.ExitNeedsPin:
+			fmt.Printf("Type %sexit%s to leave.\n", BoldText, NormalText)
+			continue
+		case err == io.EOF:
+			return
+		case err != nil:
+			log.Printf("read command: %v", err)
+			return
+		}
+		executeLine(line)
 	}
 }
 
@@ -111,24 +341,28 @@ func init() {
 		Name:        "days",
 		Aliases:     []string{"day", "week"},
 		Description: "Display days of the week",
+		Category:    categoryLearning,
 		Func:        doDays,
 	})
 	registerCommand(Command{
 		Name:        "months",
 		Aliases:     []string{"month"},
 		Description: "Display months of the year",
+		Category:    categoryLearning,
 		Func:        doMonths,
 	})
 	registerCommand(Command{
 		Name:        "calendar",
 		Aliases:     []string{"cal"},
 		Description: "Display the current month as a calendar",
+		Category:    categoryLearning,
 		Func:        doCal,
 	})
 	registerCommand(Command{
 		Name:        "news",
 		Aliases:     []string{},
 		Description: "Display the news",
+		Category:    categoryNews,
 		Func:        doNews,
 	})
 	registerCommand(Command{ // TODO: Reconsider the name of this command.
@@ -143,16 +377,30 @@ func init() {
 		Description: "Display your birthday and those of your family members",
 		Func:        doBday,
 	})
-	registerCommand(Command{ // TODO: Reconsider this command entirely: why not add / subtract, etc.?
+	registerCommand(Command{
 		Name:        "calculator",
 		Aliases:     []string{"calc"},
-		Description: "Calculator",
+		Description: "Work out a sum like 3 + 4 × (2 - 1)",
+		Category:    categoryLearning,
 		Func:        doCalc,
 	})
+	registerCommand(Command{
+		Name:        "drill",
+		Description: "Practice math facts with flash cards, like drill multiply",
+		Category:    categoryLearning,
+		Func:        doDrill,
+	})
+	registerCommand(Command{
+		Name:        "fractions",
+		Description: "Choose whether answers are mixed numbers like 3 1/4 or decimals like 3.25",
+		Category:    categoryLearning,
+		Func:        doFractions,
+	})
 	registerCommand(Command{
 		Name:        "alphabet",
 		Aliases:     []string{"abc"},
 		Description: "Display the alphabet",
+		Category:    categoryLearning,
 		Func:        doABC,
 	})
 	registerCommand(Command{
@@ -176,19 +424,22 @@ func init() {
 	registerCommand(Command{
 		Name:        "numbers",
 		Aliases:     []string{"nums", "num"},
-		Description: "Display Numbers",
+		Description: "Display numbers, spell out one like numbers 4372, or play numbers quiz",
+		Category:    categoryLearning,
 		Func:        doNum,
 	})
 	registerCommand(Command{
 		Name:        "compare",
 		Aliases:     []string{"cmp"},
 		Description: "Compare two or more numbers",
+		Category:    categoryLearning,
 		Func:        doCompare,
 	})
 	registerCommand(Command{
 		Name:        "count",
 		Aliases:     []string{"cnt"},
 		Description: "Count up to a number",
+		Category:    categoryLearning,
 		Func:        doCount,
 	})
 	registerCommand(Command{
@@ -243,18 +494,21 @@ func init() {
 		Name:        "add",
 		Aliases:     []string{"sum", "total"},
 		Description: "Print the sum of all arguments added together",
+		Category:    categoryLearning,
 		Func:        doAdd,
 	})
 	registerCommand(Command{
 		Name:        "multiply",
 		Aliases:     []string{"mult", "mul"},
 		Description: "Print the product of all arguments multiplied together",
+		Category:    categoryLearning,
 		Func:        doMultiply,
 	})
 	registerCommand(Command{
 		Name:        "weather",
 		Aliases:     []string{"wtr"},
 		Description: "Print the weather",
+		Category:    categoryNews,
 		Func:        doWeather,
 	})
 	registerCommand(Command{
@@ -279,18 +533,21 @@ func init() {
 		Name:        "shuffle",
 		Aliases:     []string{"shuf"},
 		Description: "Randomly re-arrange the arguments",
+		Category:    categoryGames,
 		Func:        doShuffle,
 	})
 	registerCommand(Command{
 		Name:        "random",
 		Aliases:     []string{"rand"},
 		Description: "Print a random number",
+		Category:    categoryGames,
 		Func:        doRandom,
 	})
 	registerCommand(Command{
 		Name:        "cointoss",
 		Aliases:     []string{"coin", "flip", "coinflip"},
 		Description: "Flip a coin",
+		Category:    categoryGames,
 		Func:        doFlip,
 	})
 	registerCommand(Command{
@@ -303,6 +560,7 @@ func init() {
 		Name:        "compass",
 		Aliases:     []string{},
 		Description: "Print a compass",
+		Category:    categoryLearning,
 		Func:        doCompass,
 	})
 	registerCommand(Command{
@@ -321,6 +579,7 @@ func init() {
 		Name:        "seasons",
 		Aliases:     []string{"season"},
 		Description: "Display the seasons of the year",
+		Category:    categoryLearning,
 		Func:        doSeasons,
 	})
 	registerCommand(Command{
@@ -371,6 +630,24 @@ func init() {
 		Description: "Display the todo list or add something to it",
 		Func:        doTodo,
 	})
+	registerCommand(Command{
+		Name:        "note",
+		Aliases:     []string{"n"},
+		Description: "Write a note, like: note -color blue I like cats",
+		Func:        doNote,
+	})
+	registerCommand(Command{
+		Name:        "notes",
+		Aliases:     []string{},
+		Description: "List your notes, or read, search or delete them",
+		Func:        doNotes,
+	})
+	registerCommand(Command{
+		Name:        "edit",
+		Aliases:     []string{},
+		Description: "Write a story or anything else, like: edit story.txt",
+		Func:        doEdit,
+	})
 	registerCommand(Command{
 		Name:        "done",
 		Aliases:     []string{},
@@ -417,48 +694,63 @@ func init() {
 		Name:        "subtract",
 		Aliases:     []string{"sub"},
 		Description: "Subtract one number from another",
+		Category:    categoryLearning,
 		Func:        doSubtract,
 	})
+	registerCommand(Command{
+		Name:        "divide",
+		Aliases:     []string{"div"},
+		Description: "Divide one number by another, with the remainder",
+		Category:    categoryLearning,
+		Func:        doDivide,
+	})
 	registerCommand(Command{
 		Name:        "countgame",
 		Aliases:     []string{},
 		Description: "Guess the number of Os",
+		Category:    categoryGames,
 		Func:        doCountGame,
 	})
 	registerCommand(Command{
 		Name:        "news",
 		Aliases:     []string{},
 		Description: "Show the news",
+		Category:    categoryNews,
 		Func:        doNews,
 	})
 	registerCommand(Command{
 		Name:        "read",
 		Aliases:     []string{"cat"},
 		Description: "Read a file",
+		Category:    categoryLearning,
 		Func:        doCat,
 	})
 	registerCommand(Command{
 		Name:        "and",
 		Aliases:     []string{},
 		Description: "Logical AND",
+		Category:    categoryLearning,
 		Func:        doAnd,
 	})
 	registerCommand(Command{
 		Name:        "or",
 		Aliases:     []string{},
 		Description: "Logical OR",
+		Category:    categoryLearning,
 		Func:        doOr,
 	})
 	registerCommand(Command{
 		Name:        "xor",
 		Aliases:     []string{},
 		Description: "Logical XOR",
+		Category:    categoryLearning,
 		Func:        doXor,
 	})
 	registerCommand(Command{
 		Name:        "not",
 		Aliases:     []string{},
 		Description: "Logical NOT",
+		Category:    categoryLearning,
 		Func:        doNot,
 	})
 	registerCommand(Command{
@@ -485,19 +777,91 @@ func init() {
 		Description: "Speak a string",
 		Func:        doSpeak,
 	})
+	registerCommand(Command{
+		Name:        adminCommand,
+		Aliases:     []string{},
+		Description: "Parent settings (asks for the parent PIN)",
+		Func:        doAdmin,
+	})
+	registerCommand(Command{
+		Name:        "timeleft",
+		Aliases:     []string{},
+		Description: "Show how much screen time is left today",
+		Func:        doTimeLeft,
+	})
+	registerCommand(Command{
+		Name:        "protections",
+		Aliases:     []string{},
+		Description: "Show how the shell is locked down",
+		Func:        doProtections,
+	})
 	registerCommand(Command{
 		Name:        "bible",
 		Aliases:     []string{},
 		Description: "Display a Bible verse",
+		Category:    categoryLearning,
 		Func:        doBible,
 	})
 }
 
 func main() {
+	flag.Parse()
 	if flags.PrintVersionAndExit {
 		fmt.Println(version)
 		os.Exit(0)
 	}
+	if isLoginShell() && !isLoginSession() && !flags.SetPin {
+		os.Exit(superviseLogin())
+	}
+	var err error
+	config, configPath, err = loadConfig(flags.ConfigFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := resolveAuditLogFile(config); err != nil {
+		log.Fatalf("audit log: %v", err)
+	}
+	if isLoginSession() {
+		// Only a parent may leave a login shell.
+		config.ExitNeedsPin = true
+	}
+	if flags.SetPin {
+		c := &CommandContext{Ctx: context.Background(), Stdin: newTerminal(os.Stdin), Stdout: os.Stdout}
+		hash, err := askNewPin(c)
+		if err == nil {
+			err = updateConfig(config, func(cfg *Config) { cfg.AdminPinHash = hash })
+		}
+		if err != nil {
+			log.Fatalf("set PIN: %v", err)
+		}
+		fmt.Printf("The parent PIN has been saved in %s.\n", configPath)
+		os.Exit(0)
+	}
+	profile, err := chooseProfile(config, flags.Profile, os.Stdin, os.Stdout)
+	if err != nil {
+		log.Fatalf("profile: %v", err)
+	}
+	if err := harden(config, profile); err != nil {
+		log.Fatalf("harden: %v", err)
+	}
+	if flags.Verbose {
+		for _, p := range protections {
+			log.Printf("protection %s: active=%v %s", p.Name, p.Active, p.Detail)
+		}
+	}
+	if err := openAuditLog(config); err != nil {
+		log.Printf("open audit log: %v", err)
+	}
+	session, err = openSession(profile)
+	if err != nil {
+		log.Fatalf("open profile %q: %v", profile, err)
+	}
+	handleSignals()
+	random = newRandom(flags.Seed)
+	clock, err = newClock(flags.Now)
+	if err != nil {
+		log.Fatalf("-now: %v", err)
+	}
 	commandReader = os.Stdin
 	postionalArg0, _ = os.Executable()
 	switch {
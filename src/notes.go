@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// notesFileName is where a child's notes are kept, in their profile's
+// directory.
+const notesFileName = "notes.json"
+
+// Note is something a child wrote down.
+type Note struct {
+	Time  time.Time `json:"time"`
+	Text  string    `json:"text"`
+	Color string    `json:"color,omitempty"`
+}
+
+// noteColors are the colors a note can be, by the ANSI code for each.
+var noteColors = map[string]int{
+	"red":     31,
+	"green":   32,
+	"yellow":  33,
+	"blue":    34,
+	"purple":  35,
+	"magenta": 35,
+	"cyan":    36,
+	"white":   37,
+}
+
+// rainbow is the order notes without a color are shown in, like todos.
+var rainbow = []int{31, 32, 33, 34, 35, 36, 37}
+
+func (s *Session) notesPath() string {
+	return filepath.Join(s.Dir, notesFileName)
+}
+
+func readNotes(c *CommandContext) ([]Note, error) {
+	data, err := os.ReadFile(c.Session.notesPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var notes []Note
+	if err := json.Unmarshal(data, &notes); err != nil {
+		return nil, fmt.Errorf("%s: %v", notesFileName, err)
+	}
+	return notes, nil
+}
+
+func writeNotes(c *CommandContext, notes []Note) error {
+	data, err := json.MarshalIndent(notes, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.Session.notesPath(), data, 0600)
+}
+
+// noteColor returns the ANSI color to show the nth note (counting from 1)
+// in.
+func noteColor(n int, note Note) int {
+	if code, ok := noteColors[note.Color]; ok {
+		return code
+	}
+	return rainbow[(n-1)%len(rainbow)]
+}
+
+// showNote prints the nth note on one line, with its date.
+func showNote(c *CommandContext, n int, note Note) {
+	if c.PipedOut {
+		fmt.Fprintln(c.Stdout, note.Text)
+		return
+	}
+	fmt.Fprintf(c.Stdout, "\033[%dm[%d] %s  %s\033[0m\n", noteColor(n, note), n, note.Time.Format("Jan 2"), note.Text)
+}
+
+func colorNames() string {
+	names := make([]string, 0, len(noteColors))
+	for name := range noteColors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func doNote(c *CommandContext, args []string) error {
+	color := ""
+	if len(args) > 0 && args[0] == "-color" {
+		if len(args) < 2 {
+			return fmt.Errorf("which color? Try one of %s", colorNames())
+		}
+		color = strings.ToLower(args[1])
+		if _, ok := noteColors[color]; !ok {
+			return fmt.Errorf("I don't know the color %q. Try one of %s", args[1], colorNames())
+		}
+		args = args[2:]
+	}
+	text := strings.Join(args, " ")
+	if text == "" {
+		fmt.Fprintf(c.Stdout, "What should the note say? Type %snote%s and then your note.\n", BoldText, NormalText)
+		return nil
+	}
+	notes, err := readNotes(c)
+	if err != nil {
+		return err
+	}
+	notes = append(notes, Note{Time: c.Clock.Now(), Text: text, Color: color})
+	if err := writeNotes(c, notes); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Stdout, "Saved note %d.\n", len(notes))
+	return nil
+}
+
+// noteNumber returns the index of the note numbered arg.
+func noteNumber(notes []Note, arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(notes) {
+		switch len(notes) {
+		case 0:
+			return 0, fmt.Errorf("there are no notes yet")
+		case 1:
+			return 0, fmt.Errorf("%q is not a note; there is only note 1", arg)
+		}
+		return 0, fmt.Errorf("%q is not a note; pick a number from 1 to %d", arg, len(notes))
+	}
+	return n - 1, nil
+}
+
+func doNotes(c *CommandContext, args []string) error {
+	notes, err := readNotes(c)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		if len(notes) == 0 {
+			fmt.Fprintf(c.Stdout, "No notes yet. Type %snote%s and then your note to write one.\n", BoldText, NormalText)
+			return nil
+		}
+		for i, note := range notes {
+			showNote(c, i+1, note)
+		}
+		return nil
+	}
+	switch args[0] {
+	case "read":
+		if len(args) != 2 {
+			return fmt.Errorf("which note? Type notes read and its number")
+		}
+		i, err := noteNumber(notes, args[1])
+		if err != nil {
+			return err
+		}
+		note := notes[i]
+		fmt.Fprintf(c.Stdout, "%sNote %d, written %s%s\n", BoldText, i+1, note.Time.Format("Monday, January 2, 2006 at 3:04 PM"), NormalText)
+		fmt.Fprintf(c.Stdout, "\033[%dm%s\033[0m\n", noteColor(i+1, note), note.Text)
+	case "search":
+		if len(args) < 2 {
+			return fmt.Errorf("what should I look for? Type notes search and a word")
+		}
+		word := strings.ToLower(strings.Join(args[1:], " "))
+		found := false
+		for i, note := range notes {
+			if strings.Contains(strings.ToLower(note.Text), word) {
+				showNote(c, i+1, note)
+				found = true
+			}
+		}
+		if !found {
+			fmt.Fprintf(c.Stdout, "No notes say %q.\n", word)
+		}
+	case "delete":
+		if len(args) != 2 {
+			return fmt.Errorf("which note? Type notes delete and its number")
+		}
+		i, err := noteNumber(notes, args[1])
+		if err != nil {
+			return err
+		}
+		notes = append(notes[:i], notes[i+1:]...)
+		if err := writeNotes(c, notes); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.Stdout, "Deleted note %d.\n", i+1)
+	default:
+		return fmt.Errorf("notes can read, search or delete, not %q", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxNumberWords is one more than the biggest number numbers can spell
+// out: 999 trillion, 999 billion and so on.
+const maxNumberWords = 1_000_000_000_000_000
+
+var onesWords = []string{
+	"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+	"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen",
+	"seventeen", "eighteen", "nineteen",
+}
+
+var tensWords = []string{
+	"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety",
+}
+
+// scaleWords name each group of three digits, from the right.
+var scaleWords = []string{"", "thousand", "million", "billion", "trillion"}
+
+// hundredsWords spells out n, which is from 1 to 999.
+func hundredsWords(n int64) string {
+	var words []string
+	if n >= 100 {
+		words = append(words, onesWords[n/100], "hundred")
+		n %= 100
+	}
+	switch {
+	case n >= 20 && n%10 != 0:
+		words = append(words, tensWords[n/10]+"-"+onesWords[n%10])
+	case n >= 20:
+		words = append(words, tensWords[n/10])
+	case n > 0:
+		words = append(words, onesWords[n])
+	}
+	return strings.Join(words, " ")
+}
+
+// numberWords spells out n in English words, like "four thousand three
+// hundred seventy-two". n must be less than maxNumberWords away from 0.
+func numberWords(n int64) string {
+	if n == 0 {
+		return onesWords[0]
+	}
+	if n < 0 {
+		return "minus " + numberWords(-n)
+	}
+	var groups []string
+	for scale := 0; n > 0; scale++ {
+		if group := n % 1000; group > 0 {
+			words := hundredsWords(group)
+			if scaleWords[scale] != "" {
+				words += " " + scaleWords[scale]
+			}
+			groups = append([]string{words}, groups...)
+		}
+		n /= 1000
+	}
+	return strings.Join(groups, " ")
+}
+
+// withCommas writes n with commas between groups of three digits, like
+// 4,372.
+func withCommas(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return sign + s
+}
+
+var romanNumerals = []struct {
+	value   int64
+	numeral string
+}{
+	{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"},
+	{100, "C"}, {90, "XC"}, {50, "L"}, {40, "XL"},
+	{10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+}
+
+// romanNumeral writes n, from 1 to 3999, in Roman numerals.
+func romanNumeral(n int64) string {
+	var b strings.Builder
+	for _, r := range romanNumerals {
+		for n >= r.value {
+			b.WriteString(r.numeral)
+			n -= r.value
+		}
+	}
+	return b.String()
+}
+
+// maxTally is the most tally marks numbers will draw.
+const maxTally = 100
+
+// tallyMarks draws n as tally marks in groups of five, where the fifth
+// mark crosses out the other four.
+func tallyMarks(n int64) string {
+	var groups []string
+	for ; n >= 5; n -= 5 {
+		groups = append(groups, "||||/")
+	}
+	if n > 0 {
+		groups = append(groups, strings.Repeat("|", int(n)))
+	}
+	return strings.Join(groups, " ")
+}
+
+// parseWholeNumber parses a whole number that numbers can spell out.
+// Commas between digits, as in 4,372, are allowed.
+func parseWholeNumber(s string) (int64, error) {
+	n, err := strconv.ParseInt(strings.ReplaceAll(s, ",", ""), 10, 64)
+	if err != nil && !isWholeNumber(strings.ReplaceAll(s, ",", "")) {
+		return 0, fmt.Errorf("%q isn't a whole number; try one like 4372", s)
+	}
+	if err != nil || n <= -maxNumberWords || n >= maxNumberWords {
+		return 0, fmt.Errorf("%s is too big for me; I know numbers up to 999 trillion", s)
+	}
+	return n, nil
+}
+
+// explainNumber shows n in words, by place value, in tally marks and in
+// Roman numerals.
+func explainNumber(c *CommandContext, n int64) {
+	fmt.Fprintf(c.Stdout, "%s%s%s\n", BoldText, withCommas(n), NormalText)
+	fmt.Fprintf(c.Stdout, "In words: %s\n", numberWords(n))
+
+	fmt.Fprintln(c.Stdout)
+	fmt.Fprintln(c.Stdout, "Place value:")
+	digits := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	width := len(withCommas(n))
+	nameWidth := 0
+	for k := range digits {
+		if len(placeName(k)) > nameWidth {
+			nameWidth = len(placeName(k))
+		}
+	}
+	for i, d := range digits {
+		k := len(digits) - 1 - i
+		value, _ := strconv.ParseInt(string(d)+strings.Repeat("0", k), 10, 64)
+		if sign != "" {
+			value = -value
+		}
+		fmt.Fprintf(c.Stdout, "  %s in the %-*s place = %*s\n", highlightYellow(string(d)), nameWidth, placeName(k), width, withCommas(value))
+	}
+
+	fmt.Fprintln(c.Stdout)
+	switch {
+	case n <= 0:
+		fmt.Fprintf(c.Stdout, "Tally marks: there are no tally marks for %s.\n", withCommas(n))
+	case n > maxTally && n%5 == 0:
+		fmt.Fprintf(c.Stdout, "Tally marks: too many to draw! That's %s groups of five.\n", withCommas(n/5))
+	case n > maxTally:
+		fmt.Fprintf(c.Stdout, "Tally marks: too many to draw! That's %s groups of five and %d more.\n", withCommas(n/5), n%5)
+	default:
+		fmt.Fprintf(c.Stdout, "Tally marks: %s\n", tallyMarks(n))
+	}
+	switch {
+	case n == 0:
+		fmt.Fprintln(c.Stdout, "Roman numerals: the Romans didn't have a numeral for zero.")
+	case n < 0:
+		fmt.Fprintln(c.Stdout, "Roman numerals: the Romans didn't write numbers below zero.")
+	case n >= 4000:
+		fmt.Fprintf(c.Stdout, "Roman numerals: they only go up to 3,999, so there isn't one for %s.\n", withCommas(n))
+	default:
+		fmt.Fprintf(c.Stdout, "Roman numerals: %s\n", romanNumeral(n))
+	}
+}
+
+// numberQuestion is one question in the numbers quiz. An answer is right
+// if it is the same as answer after both have been through normalize.
+type numberQuestion struct {
+	ask       string
+	answer    string
+	normalize func(string) string
+}
+
+func normalizeNumber(s string) string {
+	return strings.NewReplacer(",", "", " ", "").Replace(s)
+}
+
+func normalizeWords(s string) string {
+	s = strings.NewReplacer("-", " ", ",", "").Replace(strings.ToLower(s))
+	var words []string
+	for _, word := range strings.Fields(s) {
+		if word != "and" {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func normalizeRoman(s string) string {
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+// randomNumberQuestion makes up a question about turning a number from one
+// way of writing it into another.
+func randomNumberQuestion(c *CommandContext) numberQuestion {
+	switch c.Rand.Intn(6) {
+	case 0:
+		n := int64(c.Rand.Intn(9999) + 1)
+		return numberQuestion{fmt.Sprintf("Write %s in numbers.", numberWords(n)), strconv.FormatInt(n, 10), normalizeNumber}
+	case 1:
+		n := int64(c.Rand.Intn(999) + 1)
+		return numberQuestion{fmt.Sprintf("Write %d in words.", n), numberWords(n), normalizeWords}
+	case 2:
+		n := int64(c.Rand.Intn(100) + 1)
+		return numberQuestion{fmt.Sprintf("Write %d in Roman numerals.", n), romanNumeral(n), normalizeRoman}
+	case 3:
+		n := int64(c.Rand.Intn(100) + 1)
+		return numberQuestion{fmt.Sprintf("What number is %s in Roman numerals?", romanNumeral(n)), strconv.FormatInt(n, 10), normalizeNumber}
+	case 4:
+		n := int64(c.Rand.Intn(30) + 1)
+		return numberQuestion{fmt.Sprintf("How many tally marks are there?  %s", tallyMarks(n)), strconv.FormatInt(n, 10), normalizeNumber}
+	}
+	n := int64(c.Rand.Intn(999000) + 1000)
+	digits := strconv.FormatInt(n, 10)
+	k := c.Rand.Intn(len(digits))
+	return numberQuestion{fmt.Sprintf("Which digit is in the %s place of %s?", placeName(k), withCommas(n)), string(digits[len(digits)-1-k]), normalizeNumber}
+}
+
+// numbersQuizLength is how many questions numbers quiz asks unless it is
+// told otherwise.
+const numbersQuizLength = 5
+
+// numbersQuiz asks questions about writing numbers in different ways and
+// keeps score.
+func numbersQuiz(c *CommandContext, args []string) error {
+	count := numbersQuizLength
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("how many questions? Try numbers quiz 10")
+		}
+		count = n
+	}
+	right, asked := 0, 0
+	for asked < count {
+		q := randomNumberQuestion(c)
+		fmt.Fprintf(c.Stdout, "%sQuestion %d:%s %s\n", BoldText, asked+1, NormalText, q.ask)
+		answer, err := readAnswer(c, "> ")
+		if err == io.EOF || err == errInterrupted {
+			fmt.Fprintln(c.Stdout)
+			break
+		}
+		if err != nil {
+			return err
+		}
+		asked++
+		if q.normalize(answer) == q.normalize(q.answer) {
+			right++
+			fmt.Fprintf(c.Stdout, "%sThat's right!%s\n", GreenText, NormalText)
+		} else {
+			fmt.Fprintf(c.Stdout, "%sNot quite. The answer is %s.%s\n", YellowText, q.answer, NormalText)
+		}
+	}
+	if asked > 0 {
+		fmt.Fprintf(c.Stdout, "You got %d out of %d right.\n", right, asked)
+	}
+	return nil
+}
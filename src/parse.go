@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseError reports a problem with a command line and where it is.
+type ParseError struct {
+	Column  int // Counted in characters, starting at 1.
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Message)
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || (r >= '0' && r <= '9')
+}
+
+type lineParser struct {
+	line   []rune
+	pos    int
+	lookup func(name string) string
+}
+
+// expand reads a variable reference at p.pos, which is just after a '$',
+// and returns its value. A '$' that isn't followed by a name is kept as is.
+func (p *lineParser) expand() (string, error) {
+	start := p.pos - 1
+	if p.pos < len(p.line) && p.line[p.pos] == '{' {
+		end := p.pos + 1
+		for end < len(p.line) && p.line[end] != '}' {
+			end++
+		}
+		if end == len(p.line) {
+			return "", &ParseError{start + 1, "this ${ needs a } to close it"}
+		}
+		name := string(p.line[p.pos+1 : end])
+		if name == "" {
+			return "", &ParseError{start + 1, "there needs to be a name between ${ and }"}
+		}
+		p.pos = end + 1
+		return p.lookup(name), nil
+	}
+	if p.pos >= len(p.line) || !isNameStart(p.line[p.pos]) {
+		return "$", nil
+	}
+	end := p.pos
+	for end < len(p.line) && isNameChar(p.line[end]) {
+		end++
+	}
+	name := string(p.line[p.pos:end])
+	p.pos = end
+	return p.lookup(name), nil
+}
+
+// parsePipeline splits a command line into commands separated by | and
+// each command into words. It understands 'single quotes', "double
+// quotes", backslash escapes, $NAME and ${NAME}, and comments starting
+// with #. A blank line gives no commands at all.
+func parsePipeline(line string, lookup func(name string) string) ([][]string, error) {
+	p := &lineParser{line: []rune(line), lookup: lookup}
+	var pipeline [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+	lastPipe := 0
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	finish := func() ([][]string, error) {
+		endWord()
+		if len(words) == 0 && len(pipeline) > 0 {
+			return nil, &ParseError{lastPipe, "there needs to be a command after this |"}
+		}
+		if len(words) > 0 {
+			pipeline = append(pipeline, words)
+		}
+		return pipeline, nil
+	}
+	for p.pos < len(p.line) {
+		r := p.line[p.pos]
+		p.pos++
+		switch {
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+			endWord()
+		case r == '#' && !inWord:
+			return finish()
+		case r == '|':
+			endWord()
+			if len(words) == 0 {
+				return nil, &ParseError{p.pos, "there needs to be a command before this |"}
+			}
+			pipeline = append(pipeline, words)
+			words = nil
+			lastPipe = p.pos
+		case r == '\\':
+			if p.pos == len(p.line) {
+				return nil, &ParseError{p.pos, `there is a \ at the end with nothing after it`}
+			}
+			word.WriteRune(p.line[p.pos])
+			p.pos++
+			inWord = true
+		case r == '\'':
+			start := p.pos
+			for p.pos < len(p.line) && p.line[p.pos] != '\'' {
+				p.pos++
+			}
+			if p.pos == len(p.line) {
+				return nil, &ParseError{start, "this ' quote never got closed"}
+			}
+			word.WriteString(string(p.line[start:p.pos]))
+			p.pos++
+			inWord = true
+		case r == '"':
+			start := p.pos
+			for {
+				if p.pos == len(p.line) {
+					return nil, &ParseError{start, `this " quote never got closed`}
+				}
+				c := p.line[p.pos]
+				p.pos++
+				if c == '"' {
+					break
+				}
+				switch {
+				case c == '\\' && p.pos < len(p.line) && strings.ContainsRune(`"\$`, p.line[p.pos]):
+					word.WriteRune(p.line[p.pos])
+					p.pos++
+				case c == '$':
+					value, err := p.expand()
+					if err != nil {
+						return nil, err
+					}
+					word.WriteString(value)
+				default:
+					word.WriteRune(c)
+				}
+			}
+			inWord = true
+		case r == '$':
+			value, err := p.expand()
+			if err != nil {
+				return nil, err
+			}
+			word.WriteString(value)
+			inWord = inWord || value != ""
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	return finish()
+}
+
+// showParseError prints the line with an arrow under the problem.
+func showParseError(w io.Writer, line string, err *ParseError) {
+	fmt.Fprintln(w, line)
+	fmt.Fprintf(w, "%s%s^%s\n", strings.Repeat(" ", err.Column-1), BoldRedText, NormalText)
+	fmt.Fprintf(w, "Oops! I got confused here: %s.\n", err.Message)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePipeline(t *testing.T) {
+	vars := map[string]string{"NAME": "Ada", "EMPTY": ""}
+	lookup := func(name string) string { return vars[name] }
+	tests := []struct {
+		line string
+		want [][]string
+	}{
+		{"", nil},
+		{"   \t ", nil},
+		{"# just a comment", nil},
+		{"colors", [][]string{{"colors"}}},
+		{"say  hello\tworld ", [][]string{{"say", "hello", "world"}}},
+		{"say 'a  b'", [][]string{{"say", "a  b"}}},
+		{`say 'no $NAME \ here'`, [][]string{{"say", `no $NAME \ here`}}},
+		{`say 'don'\''t'`, [][]string{{"say", "don't"}}},
+		{`say "a \"b\" \\ \$NAME \n"`, [][]string{{"say", `a "b" \ $NAME \n`}}},
+		{`say a\ b \#not \|`, [][]string{{"say", "a b", "#not", "|"}}},
+		{"say a#b # and the rest", [][]string{{"say", "a#b"}}},
+		{"say $NAME ${NAME}s", [][]string{{"say", "Ada", "Adas"}}},
+		{`say "$NAME and $EMPTY"`, [][]string{{"say", "Ada and "}}},
+		{"say $EMPTY", [][]string{{"say"}}},
+		{`say "" ''`, [][]string{{"say", "", ""}}},
+		{"say $ 5$ $5", [][]string{{"say", "$", "5$", "$5"}}},
+		{"days | first", [][]string{{"days"}, {"first"}}},
+		{"a|b|c", [][]string{{"a"}, {"b"}, {"c"}}},
+		{`say "a | b" | upper`, [][]string{{"say", "a | b"}, {"upper"}}},
+	}
+	for _, tt := range tests {
+		got, err := parsePipeline(tt.line, lookup)
+		if err != nil {
+			t.Errorf("parsePipeline(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePipeline(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParsePipelineErrors(t *testing.T) {
+	lookup := func(name string) string { return "" }
+	tests := []struct {
+		line    string
+		column  int
+		message string
+	}{
+		{"| first", 1, "there needs to be a command before this |"},
+		{"days || first", 7, "there needs to be a command before this |"},
+		{"days |", 6, "there needs to be a command after this |"},
+		{"days | # first", 6, "there needs to be a command after this |"},
+		{"say 'hi", 5, "this ' quote never got closed"},
+		{`say "hi`, 5, `this " quote never got closed`},
+		{`say "hi\"`, 5, `this " quote never got closed`},
+		{`say hi\`, 7, `there is a \ at the end with nothing after it`},
+		{"say ${NAME", 5, "this ${ needs a } to close it"},
+		{"say ${}", 5, "there needs to be a name between ${ and }"},
+		{`say "${NAME"`, 6, "this ${ needs a } to close it"},
+		{`é "x`, 3, `this " quote never got closed`},
+	}
+	for _, tt := range tests {
+		_, err := parsePipeline(tt.line, lookup)
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("parsePipeline(%q) error = %v, want a ParseError", tt.line, err)
+			continue
+		}
+		if perr.Column != tt.column || perr.Message != tt.message {
+			t.Errorf("parsePipeline(%q) error = %v, want column %d: %s", tt.line, perr, tt.column, tt.message)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultProfile is used when the config does not list any profiles.
+const defaultProfile = "default"
+
+// Profile is the config for one child.
+type Profile struct {
+	// MyName is the formatted name (FN) of the child's own vCard, used by
+	// home, birthday and age. It defaults to the top-level myName.
+	MyName string `json:"myName"`
+
+	// AllowedCommands, if not empty, are the only commands the child may
+	// run, by their full names.
+	AllowedCommands []string `json:"allowedCommands"`
+
+	// Drill, if not empty, is used by drill instead of the top-level drill.
+	Drill map[string]*DrillRange `json:"drill"`
+}
+
+func validProfileName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	return !strings.ContainsAny(name, `/\`) && !strings.HasPrefix(name, ".")
+}
+
+func (c *Config) validateProfiles() error {
+	for name, p := range c.Profiles {
+		key := "profiles." + name
+		if !validProfileName(name) {
+			return &ConfigError{key, fmt.Errorf("%q cannot be used as a profile name", name)}
+		}
+		if p == nil {
+			return &ConfigError{key, fmt.Errorf("must not be null")}
+		}
+		for i, cmdName := range p.AllowedCommands {
+			if cmd, ok := cmds[cmdName]; !ok || cmd.Name != cmdName {
+				return &ConfigError{fmt.Sprintf("%s.allowedCommands[%d]", key, i), fmt.Errorf("there is no command named %q", cmdName)}
+			}
+		}
+		if err := validateDrill(key+".drill", p.Drill); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) profileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commandAllowed reports whether the profile may run the command. The
+// admin command is always allowed, since it asks for the parent PIN.
+func (c *Config) commandAllowed(profile string, cmd *Command) bool {
+	if cmd.Name == adminCommand {
+		return true
+	}
+	if slices.Contains(c.DisabledCommands, cmd.Name) {
+		return false
+	}
+	p := c.Profiles[profile]
+	if p == nil || len(p.AllowedCommands) == 0 {
+		return true
+	}
+	for _, name := range p.AllowedCommands {
+		if name == cmd.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// myName returns the name on the vCard of the child using the shell.
+func (c *CommandContext) myName() string {
+	if p := c.Config.Profiles[c.Session.Profile]; p != nil && p.MyName != "" {
+		return p.MyName
+	}
+	return c.Config.MyName
+}
+
+// chooseProfile picks the profile named on the command line, the only one
+// there is, or asks who is using the computer if in is a terminal.
+func chooseProfile(cfg *Config, name string, in *os.File, out io.Writer) (string, error) {
+	names := cfg.profileNames()
+	switch {
+	case len(names) == 0 && (name == "" || name == defaultProfile):
+		return defaultProfile, nil
+	case name != "":
+		if cfg.Profiles[name] == nil {
+			return "", fmt.Errorf("there is no profile named %q", name)
+		}
+		return name, nil
+	case len(names) == 1:
+		return names[0], nil
+	case !isTerminal(int(in.Fd())):
+		return "", fmt.Errorf("choose a profile with -profile")
+	}
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "%sWho is using the computer?%s\n", BoldGreenText, NormalText)
+		for i, name := range names {
+			fmt.Fprintf(out, "  %d. %s\n", i+1, name)
+		}
+		fmt.Fprint(out, "Type your number or your name: ")
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		answer = strings.TrimSpace(answer)
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(names) {
+			return names[n-1], nil
+		}
+		if cfg.Profiles[answer] != nil {
+			return answer, nil
+		}
+		fmt.Fprintf(out, "I don't know who %q is. Try again!\n\n", answer)
+	}
+}
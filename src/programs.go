@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// allowedProgram returns the path to run for the external program name. In
+// strict mode, name must match one of the absolute paths in
+// config.AllowedPrograms, either exactly or by its base name, so typing
+// "lpr" runs "/usr/bin/lpr" without ever consulting PATH.
+func allowedProgram(name string) (string, bool) {
+	if !flags.Strict {
+		return name, true
+	}
+	for _, path := range config.AllowedPrograms {
+		if !filepath.IsAbs(path) {
+			continue
+		}
+		if name == path {
+			return path, true
+		}
+		if !strings.ContainsRune(name, '/') && filepath.Base(path) == name {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// programCommand is like exec.CommandContext, but only for allowlisted
+// programs.
+func programCommand(c *CommandContext, name string, args ...string) (*exec.Cmd, bool) {
+	path, ok := allowedProgram(name)
+	if !ok {
+		c.auditDenied(append([]string{name}, args...), "not an allowed program")
+		return nil, false
+	}
+	cmd := exec.CommandContext(c.Ctx, path, args...)
+	// Run it in the child's current directory, as far as it can be found.
+	if dir, err := c.Session.hostPath(c.Session.cwd()); err == nil {
+		cmd.Dir = dir
+	}
+	return cmd, true
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withPrograms sets the strict flag and the allowlist for one test.
+func withPrograms(t *testing.T, strict bool, allowed ...string) {
+	t.Helper()
+	oldStrict, oldConfig := flags.Strict, config
+	t.Cleanup(func() { flags.Strict, config = oldStrict, oldConfig })
+	flags.Strict = strict
+	config = defaultConfig()
+	config.AllowedPrograms = allowed
+}
+
+func TestAllowedProgram(t *testing.T) {
+	withPrograms(t, true, "/usr/bin/lpr", "espeak")
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"lpr", "/usr/bin/lpr", true},
+		{"/usr/bin/lpr", "/usr/bin/lpr", true},
+		{"rm", "", false},
+		{"/bin/rm", "", false},
+		// Only the exact absolute path or the bare name will do.
+		{"./lpr", "", false},
+		{"bin/lpr", "", false},
+		{"../usr/bin/lpr", "", false},
+		{"/usr/bin/../bin/lpr", "", false},
+		{"/tmp/lpr", "", false},
+		// Allowlist entries that aren't absolute paths are ignored.
+		{"espeak", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := allowedProgram(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("allowedProgram(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAllowedProgramNotStrict(t *testing.T) {
+	withPrograms(t, false)
+	if got, ok := allowedProgram("rm"); got != "rm" || !ok {
+		t.Errorf("allowedProgram(%q) = %q, %v, want any program when not strict", "rm", got, ok)
+	}
+}
+
+// TestProgramCommandIgnoresPath puts an lpr earlier on PATH and checks that
+// the allowlisted one is run instead.
+func TestProgramCommandIgnoresPath(t *testing.T) {
+	withPrograms(t, true, "/usr/bin/lpr")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "lpr"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	c, _ := newTestContext(t, "")
+	cmd, ok := programCommand(c, "lpr")
+	if !ok {
+		t.Fatal("lpr was refused")
+	}
+	if cmd.Path != "/usr/bin/lpr" {
+		t.Errorf("lpr runs %s, want /usr/bin/lpr", cmd.Path)
+	}
+}
+
+func TestProgramCommandAuditsRefusal(t *testing.T) {
+	withPrograms(t, true, "/usr/bin/lpr")
+	c, _ := newTestContext(t, "")
+	c.Config.AuditLogFile = filepath.Join(c.Session.Dir, "audit.log")
+	if err := openAuditLog(c.Config); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(auditLog.close)
+
+	if _, ok := programCommand(c, "rm", "-rf", "/"); ok {
+		t.Fatal("rm was allowed")
+	}
+	entries, err := readAuditLog(c.Config.AuditLogFile, c.Config.AuditLogMaxFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("audit log has %d entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if !e.Denied || e.Command != "rm" || len(e.Args) != 2 || e.Error != "not an allowed program" {
+		t.Errorf("audit entry = %+v, want rm -rf / denied as not an allowed program", e)
+	}
+}
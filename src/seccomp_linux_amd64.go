@@ -0,0 +1,4 @@
+package main
+
+// seccompArch is AUDIT_ARCH_X86_64.
+const seccompArch = 0xc000003e
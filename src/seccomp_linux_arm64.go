@@ -0,0 +1,4 @@
+package main
+
+// seccompArch is AUDIT_ARCH_AARCH64.
+const seccompArch = 0xc00000b7
@@ -0,0 +1,7 @@
+//go:build linux && !amd64 && !arm64
+
+package main
+
+// seccompArch is zero where kidsh doesn't know the architecture's system
+// call numbers.
+const seccompArch = 0
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const sessionFileName = "session.json"
+
+// Session is the state the shell keeps between commands. The stack and
+// queue are saved in the profile's state directory so that they are still
+// there the next time the child logs in.
+type Session struct {
+	Profile string   `json:"-"`
+	Dir     string   `json:"-"`
+	Stack   []string `json:"stack"`
+	Queue   []string `json:"queue"`
+
+	// Cwd is the current directory inside the child's files.
+	Cwd string `json:"cwd"`
+
+	// Fractions is how answers that aren't whole numbers are shown:
+	// "mixed", "decimals", or empty to look like the numbers typed.
+	Fractions string `json:"fractions,omitempty"`
+
+	// AdminUntil is when admin mode locks itself again.
+	AdminUntil time.Time `json:"-"`
+
+	// BedtimeWarning is the last bedtime warning given, in minutes.
+	BedtimeWarning int `json:"-"`
+
+	// Usage is today's screen time. LastActive is when the last command
+	// finished and LastCategory is its category.
+	Usage        *Usage    `json:"usage,omitempty"`
+	LastActive   time.Time `json:"-"`
+	LastCategory string    `json:"-"`
+}
+
+// profileDir returns the state directory of a profile.
+func profileDir(profile string) (string, error) {
+	base, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "profiles", profile), nil
+}
+
+// openSession loads the saved session of a profile, creating its state
+// directory if needed.
+func openSession(profile string) (*Session, error) {
+	dir, err := profileDir(profile)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{Profile: profile, Dir: dir}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir, sessionFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, err
+		}
+	}
+	return s, s.openJail()
+}
+
+func (s *Session) save() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.Dir, sessionFileName), data, 0600)
+}
+
+// lookupVariable expands $NAME. The stack and queue are joined with
+// spaces; anything else comes from the environment.
+func (s *Session) lookupVariable(name string) string {
+	switch name {
+	case stackVar:
+		return strings.Join(s.Stack, " ")
+	case queueVar:
+		return strings.Join(s.Queue, " ")
+	}
+	return os.Getenv(name)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// running is the command line that is running, so that Ctrl-C can stop it
+// without stopping the shell.
+var running struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// hungUp is set when the terminal goes away.
+var hungUp atomic.Bool
+
+// commandContext returns the context for a new command line and a function
+// to call when it is done.
+func commandContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	running.mu.Lock()
+	running.cancel = cancel
+	running.mu.Unlock()
+	return ctx, func() {
+		running.mu.Lock()
+		running.cancel = nil
+		running.mu.Unlock()
+		cancel()
+	}
+}
+
+func interruptCommand() {
+	running.mu.Lock()
+	defer running.mu.Unlock()
+	if running.cancel != nil {
+		running.cancel()
+	}
+}
+
+// handleSignals keeps the keys that stop a program from stopping the
+// shell. Ctrl-C stops the running command instead. Ctrl-Z and Ctrl-\ are
+// ignored. When the terminal hangs up, the running command is stopped and
+// the shell exits once it has saved the session.
+func handleSignals() {
+	signal.Ignore(append(stopSignals, syscall.SIGQUIT)...)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				hungUp.Store(true)
+			}
+			interruptCommand()
+		}
+	}()
+}
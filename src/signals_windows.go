@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// stopSignals are sent by the keys that suspend a program. Windows has none.
+var stopSignals []os.Signal
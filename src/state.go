@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// stateDir returns the directory where kidsh keeps things that should
+// survive a restart, such as the command history, creating it if needed.
+func stateDir() (string, error) {
+	dir := config.StateDir
+	if dir == "" {
+		if xdg := os.Getenv("XDG_STATE_HOME"); xdg != "" {
+			dir = filepath.Join(xdg, appName)
+		} else {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			dir = filepath.Join(home, ".local", "state", appName)
+		}
+	}
+	return dir, os.MkdirAll(dir, 0700)
+}
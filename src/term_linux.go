@@ -0,0 +1,84 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+type termState struct {
+	termios syscall.Termios
+}
+
+func ioctlTermios(fd int, req uintptr, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func isTerminal(fd int) bool {
+	var t syscall.Termios
+	return ioctlTermios(fd, syscall.TCGETS, &t) == nil
+}
+
+// saveTerminal returns the terminal's settings, to be put back with
+// restoreTerminal.
+func saveTerminal(fd int) (*termState, error) {
+	var t syscall.Termios
+	if err := ioctlTermios(fd, syscall.TCGETS, &t); err != nil {
+		return nil, err
+	}
+	return &termState{t}, nil
+}
+
+// makeRaw turns off line buffering, echo and signal keys so that the line
+// editor sees every key press. Output processing is left on, so "\n" still
+// starts a new line.
+func makeRaw(fd int) (*termState, error) {
+	var old syscall.Termios
+	if err := ioctlTermios(fd, syscall.TCGETS, &old); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Iflag &^= syscall.ICRNL | syscall.INLCR | syscall.IGNCR | syscall.IXON | syscall.ISTRIP
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctlTermios(fd, syscall.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return &termState{old}, nil
+}
+
+// setReadTimeout makes reads from a raw terminal give up after d, so that
+// the caller can get on with other things while waiting for a key. A read
+// that times out returns io.EOF.
+func setReadTimeout(fd int, d time.Duration) error {
+	var t syscall.Termios
+	if err := ioctlTermios(fd, syscall.TCGETS, &t); err != nil {
+		return err
+	}
+	t.Cc[syscall.VMIN] = 0
+	t.Cc[syscall.VTIME] = uint8(d / (100 * time.Millisecond))
+	return ioctlTermios(fd, syscall.TCSETS, &t)
+}
+
+// terminalSize returns how many columns and rows the terminal has.
+func terminalSize(fd int) (int, int, error) {
+	var ws struct {
+		rows, cols, xpixel, ypixel uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0, 0, errno
+	}
+	return int(ws.cols), int(ws.rows), nil
+}
+
+func restoreTerminal(fd int, state *termState) error {
+	return ioctlTermios(fd, syscall.TCSETS, &state.termios)
+}
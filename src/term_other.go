@@ -0,0 +1,34 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+type termState struct{}
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func saveTerminal(fd int) (*termState, error) {
+	return nil, errors.New("terminal settings are not supported on this platform")
+}
+
+func makeRaw(fd int) (*termState, error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
+
+func setReadTimeout(fd int, d time.Duration) error {
+	return errors.New("raw terminal mode is not supported on this platform")
+}
+
+func terminalSize(fd int) (int, int, error) {
+	return 0, 0, errors.New("terminal size is not supported on this platform")
+}
+
+func restoreTerminal(fd int, state *termState) error {
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The categories of commands that can be given a daily time budget.
+const (
+	categoryGames    = "games"
+	categoryNews     = "news"
+	categoryLearning = "learning"
+)
+
+var categories = []string{categoryGames, categoryNews, categoryLearning}
+
+// idleLimit is the most time between two commands that counts as using
+// the shell. Longer pauses mean the child has wandered off.
+const idleLimit = 5 * time.Minute
+
+// Usage is how much a child has used the shell on one day.
+type Usage struct {
+	Date       string                   `json:"date"`
+	Active     time.Duration            `json:"active"`
+	Categories map[string]time.Duration `json:"categories"`
+	Runs       map[string]int           `json:"runs"`
+}
+
+// todaysUsage returns the usage for the day of now, starting over when the
+// day changes.
+func (s *Session) todaysUsage(now time.Time) *Usage {
+	date := now.Format("2006-01-02")
+	if s.Usage == nil || s.Usage.Date != date {
+		s.Usage = &Usage{Date: date}
+	}
+	if s.Usage.Categories == nil {
+		s.Usage.Categories = map[string]time.Duration{}
+	}
+	if s.Usage.Runs == nil {
+		s.Usage.Runs = map[string]int{}
+	}
+	return s.Usage
+}
+
+// chargeUsage adds d to the time used today, and to category if it has one.
+func (s *Session) chargeUsage(now time.Time, category string, d time.Duration) {
+	u := s.todaysUsage(now)
+	u.Active += d
+	if category != "" {
+		u.Categories[category] += d
+	}
+}
+
+// markActive counts the time since the last command finished, up to
+// idleLimit, against the category of that command.
+func (s *Session) markActive(now time.Time) {
+	if !s.LastActive.IsZero() && now.After(s.LastActive) {
+		idle := now.Sub(s.LastActive)
+		if idle > idleLimit {
+			idle = idleLimit
+		}
+		s.chargeUsage(now, s.LastCategory, idle)
+	}
+	s.LastActive = now
+}
+
+func validateBudgets(c *Config) error {
+	if c.ScreenTimeMinutes < 0 {
+		return &ConfigError{"screenTimeMinutes", fmt.Errorf("must not be negative, got %d", c.ScreenTimeMinutes)}
+	}
+	for category, minutes := range c.CategoryMinutes {
+		key := "categoryMinutes." + category
+		if !slices.Contains(categories, category) {
+			return &ConfigError{key, fmt.Errorf("not a category; use one of %v", categories)}
+		}
+		if minutes < 0 {
+			return &ConfigError{key, fmt.Errorf("must not be negative, got %d", minutes)}
+		}
+	}
+	for name, runs := range c.CommandRuns {
+		key := "commandRuns." + name
+		if cmd, ok := cmds[name]; !ok || cmd.Name != name {
+			return &ConfigError{key, fmt.Errorf("there is no command named %q", name)}
+		}
+		if runs < 1 {
+			return &ConfigError{key, fmt.Errorf("must be at least 1, got %d; use admin disable to turn it off", runs)}
+		}
+	}
+	return nil
+}
+
+// limitedByBudget returns whether cmd counts against the budgets. A parent
+// needs admin, and a child can always see how much time is left.
+func limitedByBudget(cmd *Command) bool {
+	return cmd.Name != adminCommand && cmd.Name != "timeleft"
+}
+
+// timeBudgetMessage says whether today's screen time, or the time for
+// category, is used up, or returns "" if neither is.
+func timeBudgetMessage(cfg *Config, u *Usage, category string) string {
+	if limit := cfg.ScreenTimeMinutes; limit > 0 && u.Active >= time.Duration(limit)*time.Minute {
+		return "Sorry, you have used up all your screen time for today. Time for a break!"
+	}
+	if limit := cfg.CategoryMinutes[category]; limit > 0 && u.Categories[category] >= time.Duration(limit)*time.Minute {
+		return fmt.Sprintf("Sorry, you have used up your time for %s today.", category)
+	}
+	return ""
+}
+
+// budgetMessage says why command may not run, or returns "" if it may.
+func budgetMessage(cfg *Config, u *Usage, cmd *Command) string {
+	if !limitedByBudget(cmd) {
+		return ""
+	}
+	if msg := timeBudgetMessage(cfg, u, cmd.Category); msg != "" {
+		return msg
+	}
+	if limit, ok := cfg.CommandRuns[cmd.Name]; ok && u.Runs[cmd.Name] >= limit {
+		times := "times"
+		if limit == 1 {
+			times = "time"
+		}
+		return fmt.Sprintf("Sorry, you can only use %s %d %s a day. Try again tomorrow!", cmd.Name, limit, times)
+	}
+	return ""
+}
+
+// checkBudget counts the time since the last command and returns whether
+// pipeline fits in what is left of today's budgets. If it does, each
+// builtin in it is counted as run once. An empty pipeline only says so if
+// screen time is used up.
+func checkBudget(c *CommandContext, pipeline [][]string) bool {
+	now := c.Clock.Now()
+	c.Session.markActive(now)
+	if c.Session.adminUnlocked(now) {
+		return true
+	}
+	u := c.Session.todaysUsage(now)
+	if len(pipeline) == 0 {
+		if msg := timeBudgetMessage(c.Config, u, ""); msg != "" {
+			fmt.Fprintln(c.Stdout, msg)
+			return false
+		}
+		return true
+	}
+	for _, command := range pipeline {
+		cmd, ok := cmds[command[0]]
+		if !ok {
+			continue
+		}
+		if msg := budgetMessage(c.Config, u, cmd); msg != "" {
+			c.auditDenied(command, "screen time limit")
+			fmt.Fprintln(c.Stdout, msg)
+			return false
+		}
+	}
+	for _, command := range pipeline {
+		if cmd, ok := cmds[command[0]]; ok {
+			u.Runs[cmd.Name]++
+		}
+	}
+	return true
+}
+
+// budgetDeadline returns when the time left today for pipeline runs out,
+// counting from the end of the last command. An empty pipeline is the
+// prompt waiting for a command, where only screen time runs out, and only
+// if it does so within idleLimit.
+func budgetDeadline(cfg *Config, s *Session, pipeline [][]string, now time.Time) (time.Time, bool) {
+	if s.adminUnlocked(now) || s.LastActive.IsZero() {
+		return time.Time{}, false
+	}
+	u := s.todaysUsage(now)
+	left, limited := time.Duration(0), false
+	limit := func(used time.Duration, minutes int) {
+		if minutes <= 0 {
+			return
+		}
+		if l := minutesLeft(used, minutes); !limited || l < left {
+			left, limited = l, true
+		}
+	}
+	if len(pipeline) == 0 {
+		limit(u.Active, cfg.ScreenTimeMinutes)
+		if left > idleLimit {
+			return time.Time{}, false
+		}
+	}
+	for _, command := range pipeline {
+		if cmd, ok := cmds[command[0]]; ok && limitedByBudget(cmd) {
+			limit(u.Active, cfg.ScreenTimeMinutes)
+			limit(u.Categories[cmd.Category], cfg.CategoryMinutes[cmd.Category])
+		}
+	}
+	if !limited || left == 0 {
+		return time.Time{}, false
+	}
+	return s.LastActive.Add(left), true
+}
+
+// showBudgetUsedUp says which of the budgets for pipeline ran out while it
+// was running.
+func showBudgetUsedUp(c *CommandContext, pipeline [][]string) {
+	u := c.Session.todaysUsage(c.Clock.Now())
+	for _, command := range pipeline {
+		if cmd, ok := cmds[command[0]]; ok && limitedByBudget(cmd) {
+			if msg := timeBudgetMessage(c.Config, u, cmd.Category); msg != "" {
+				fmt.Fprintln(c.Stdout, msg)
+				return
+			}
+		}
+	}
+}
+
+func formatMinutes(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+func minutesLeft(used time.Duration, limit int) time.Duration {
+	left := time.Duration(limit)*time.Minute - used
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+func doTimeLeft(c *CommandContext, args []string) error {
+	u := c.Session.todaysUsage(c.Clock.Now())
+	limited := false
+	if limit := c.Config.ScreenTimeMinutes; limit > 0 {
+		limited = true
+		fmt.Fprintf(c.Stdout, "Screen time: %s left of %s\n", formatMinutes(minutesLeft(u.Active, limit)), formatMinutes(time.Duration(limit)*time.Minute))
+	}
+	for _, category := range categories {
+		if limit := c.Config.CategoryMinutes[category]; limit > 0 {
+			limited = true
+			fmt.Fprintf(c.Stdout, "%s: %s left of %s\n", strings.ToUpper(category[:1])+category[1:], formatMinutes(minutesLeft(u.Categories[category], limit)), formatMinutes(time.Duration(limit)*time.Minute))
+		}
+	}
+	names := make([]string, 0, len(c.Config.CommandRuns))
+	for name := range c.Config.CommandRuns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		limited = true
+		left := c.Config.CommandRuns[name] - u.Runs[name]
+		if left < 0 {
+			left = 0
+		}
+		fmt.Fprintf(c.Stdout, "%s: %d of %d left\n", name, left, c.Config.CommandRuns[name])
+	}
+	if !limited {
+		fmt.Fprintln(c.Stdout, "There are no time limits today.")
+	}
+	fmt.Fprintf(c.Stdout, "You have used the shell for %s today.\n", formatMinutes(u.Active))
+	return nil
+}
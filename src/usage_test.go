@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBudgetDeadline(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.ScreenTimeMinutes = 60
+	cfg.CategoryMinutes = map[string]int{categoryGames: 20}
+	last := testNow.Add(-time.Minute)
+	tests := []struct {
+		name     string
+		pipeline [][]string
+		active   time.Duration
+		games    time.Duration
+		unlocked bool
+		want     time.Duration // How long after last the shell locks, or 0 if it won't.
+	}{
+		{"screen time", [][]string{{"days"}}, 50 * time.Minute, 0, false, 10 * time.Minute},
+		{"games run out first", [][]string{{"countgame"}}, 30 * time.Minute, 15 * time.Minute, false, 5 * time.Minute},
+		{"screen time runs out first", [][]string{{"days"}, {"countgame"}}, 58 * time.Minute, 0, false, 2 * time.Minute},
+		{"timeleft is not limited", [][]string{{"timeleft"}}, 50 * time.Minute, 0, false, 0},
+		{"admin unlocked", [][]string{{"days"}}, 50 * time.Minute, 0, true, 0},
+		{"prompt", nil, 57 * time.Minute, 0, false, 3 * time.Minute},
+		{"prompt with more than idleLimit left", nil, 50 * time.Minute, 0, false, 0},
+		{"prompt with none left", nil, 60 * time.Minute, 0, false, 0},
+	}
+	for _, tt := range tests {
+		s := &Session{LastActive: last}
+		u := s.todaysUsage(testNow)
+		u.Active, u.Categories[categoryGames] = tt.active, tt.games
+		if tt.unlocked {
+			s.AdminUntil = testNow.Add(time.Hour)
+		}
+		got, ok := budgetDeadline(cfg, s, tt.pipeline, testNow)
+		if tt.want == 0 {
+			if ok {
+				t.Errorf("%s: budgetDeadline = %v, want none", tt.name, got)
+			}
+			continue
+		}
+		if want := last.Add(tt.want); !ok || !got.Equal(want) {
+			t.Errorf("%s: budgetDeadline = %v, %v, want %v", tt.name, got, ok, want)
+		}
+	}
+}